@@ -0,0 +1,49 @@
+// Package atomicfile replaces files without ever leaving a partially written
+// one behind.
+package atomicfile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// WriteFile writes data to the named file like ioutil.WriteFile, creating it
+// with the given permissions if necessary. The data is written to a temporary
+// file in the same directory that then replaces the named one, so a failed or
+// interrupted write leaves the previous contents intact.
+func WriteFile(name string, data []byte, perm os.FileMode) error {
+	file, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return fmt.Errorf("failed creating temporary file: %w", err)
+	}
+	if err := write(file, data, perm); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return fmt.Errorf("failed closing temporary file: %w", err)
+	}
+	if err := os.Rename(file.Name(), name); err != nil {
+		os.Remove(file.Name())
+		return fmt.Errorf("failed replacing %s: %w", name, err)
+	}
+	return nil
+}
+
+// write fills the temporary file and flushes it to disk.
+func write(file *os.File, data []byte, perm os.FileMode) error {
+	if err := file.Chmod(perm); err != nil {
+		return fmt.Errorf("failed setting permissions of temporary file: %w", err)
+	}
+	if _, err := file.Write(data); err != nil {
+		return fmt.Errorf("failed writing temporary file: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed flushing temporary file: %w", err)
+	}
+	return nil
+}
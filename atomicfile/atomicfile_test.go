@@ -0,0 +1,92 @@
+package atomicfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileCreates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atomicfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "file")
+	if err := WriteFile(name, []byte("contents"), 0640); err != nil {
+		t.Fatalf("failed writing: %v", err)
+	}
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "contents" {
+		t.Errorf("expected %q, got %q", "contents", b)
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("expected mode %v, got %v", os.FileMode(0640), info.Mode().Perm())
+	}
+}
+
+func TestWriteFileReplaces(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atomicfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(name, []byte("a much longer old version"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(name, []byte("new"), 0600); err != nil {
+		t.Fatalf("failed writing: %v", err)
+	}
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "new" {
+		t.Errorf("expected %q, got %q", "new", b)
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 {
+		t.Errorf("expected only the written file to remain, found %d files", len(infos))
+	}
+}
+
+func TestWriteFileKeepsOldContentsOnFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atomicfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// a directory cannot be replaced by a file
+	name := filepath.Join(dir, "directory")
+	if err := os.Mkdir(name, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(name, "kept"), []byte("kept"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(name, []byte("new"), 0600); err == nil {
+		t.Fatalf("expected replacing a directory to fail")
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(name, "kept")); err != nil || string(b) != "kept" {
+		t.Errorf("expected the old contents to remain, got %q (%v)", b, err)
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 {
+		t.Errorf("expected the temporary file to be removed, found %d files", len(infos))
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	forest "git.sr.ht/~whereswaldon/forest-go"
+	"git.sr.ht/~whereswaldon/forest-go/fields"
+	"git.sr.ht/~whereswaldon/forest-go/twig"
+	"git.sr.ht/~whereswaldon/wisteria/widgets"
+	"github.com/gdamore/tcell"
+)
+
+const (
+	// maxListedCommunities is the largest number of communities requested from
+	// the store
+	maxListedCommunities = 1024
+	// activityWindow is the recent period over which community activity is counted
+	activityWindow = 24 * time.Hour
+	// communityRefreshInterval is how often the displayed activity is recounted
+	communityRefreshInterval = 10 * time.Second
+)
+
+// communityDescriptionKey is the key of the twig metadata of a community that
+// holds its description
+var communityDescriptionKey = twig.Key{Name: "description", Version: 1}
+
+// communityMetadata encodes the description of a community as the twig data
+// that community metadata must hold. Without a description, the metadata is
+// empty.
+func communityMetadata(description string) ([]byte, error) {
+	description = strings.TrimSpace(description)
+	if description == "" {
+		return []byte{}, nil
+	}
+	if strings.ContainsRune(description, 0) {
+		return nil, fmt.Errorf("community description cannot contain NUL bytes")
+	}
+	metadata := twig.New()
+	metadata.Values[communityDescriptionKey] = []byte(description)
+	return metadata.MarshalBinary()
+}
+
+// CreateCommunity builds a community with the given name and description
+// signed by the configured identity and adds it to the store. Adding it to a
+// store that sprout workers subscribe to sends it to their relays.
+func CreateCommunity(config *Config, s forest.Store, name, description string) (*forest.Community, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("community name cannot be empty")
+	}
+	if strings.ContainsAny(name, "\r\n") {
+		return nil, fmt.Errorf("community name must be a single line")
+	}
+	metadata, err := communityMetadata(description)
+	if err != nil {
+		return nil, err
+	}
+	builder, err := config.Builder(s)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating node builder: %w", err)
+	}
+	community, err := builder.NewCommunity(name, metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating community: %w", err)
+	}
+	if err := s.Add(community); err != nil {
+		return nil, fmt.Errorf("failed saving community into store: %w", err)
+	}
+	return community, nil
+}
+
+// CommunityActivity summarizes the loaded replies within a community.
+type CommunityActivity struct {
+	Community *forest.Community
+	// Replies is the number of loaded replies in the community
+	Replies int
+	// Recent is the number of replies written within the activityWindow
+	Recent       int
+	Unread       int
+	LastActivity time.Time
+}
+
+// CommunitiesWidget lists every community in the store along with its activity,
+// and restricts the history to the selected community.
+type CommunitiesWidget struct {
+	*widgets.List
+	History *HistoryWidget
+
+	communities []CommunityActivity
+	// refreshed is when the communities were last listed
+	refreshed time.Time
+}
+
+// NewCommunitiesWidget creates a widget listing the communities in the history
+// widget's store.
+func NewCommunitiesWidget(history *HistoryWidget) *CommunitiesWidget {
+	c := &CommunitiesWidget{
+		List:    widgets.NewList(),
+		History: history,
+	}
+	c.Refresh()
+	return c
+}
+
+// Refresh reloads the communities from the store and recounts their activity.
+func (c *CommunitiesWidget) Refresh() {
+	c.refreshed = time.Now()
+	nodes, err := c.History.Recent(fields.NodeTypeCommunity, maxListedCommunities)
+	if err != nil {
+		log.Printf("Failed listing communities: %v", err)
+		return
+	}
+	since := time.Now().Add(-activityWindow)
+	c.communities = make([]CommunityActivity, 0, len(nodes))
+	for _, node := range nodes {
+		community, ok := node.(*forest.Community)
+		if !ok {
+			continue
+		}
+		activity := CommunityActivity{Community: community}
+		c.History.ReplyList.WithCommunityReplies(community.ID(), func(replies []*forest.Reply) {
+			activity.Replies = len(replies)
+			for _, reply := range replies {
+				created := reply.Created.Time()
+				if created.After(since) {
+					activity.Recent++
+				}
+				if created.After(activity.LastActivity) {
+					activity.LastActivity = created
+				}
+				if c.History.isUnread(reply) {
+					activity.Unread++
+				}
+			}
+		})
+		c.communities = append(c.communities, activity)
+	}
+	sort.SliceStable(c.communities, func(i, j int) bool {
+		return c.communities[i].LastActivity.After(c.communities[j].LastActivity)
+	})
+	items := make([]string, 0, len(c.communities)+1)
+	items = append(items, "All communities\n  show messages from every community")
+	for _, activity := range c.communities {
+		items = append(items, describeActivity(activity))
+	}
+	c.SetItems(items)
+}
+
+// describeActivity renders a summary of the community's activity as several lines.
+func describeActivity(activity CommunityActivity) string {
+	details := []string{fmt.Sprintf("%d loaded", activity.Replies)}
+	details = append(details, fmt.Sprintf("%d today", activity.Recent))
+	if activity.Unread > 0 {
+		details = append(details, fmt.Sprintf("%d unread", activity.Unread))
+	}
+	if !activity.LastActivity.IsZero() {
+		details = append(details, "active "+timeSince(activity.LastActivity))
+	}
+	return fmt.Sprintf("%s\n  %s", string(activity.Community.Name.Blob), strings.Join(details, ", "))
+}
+
+// Draw recounts the activity of the communities if it is out of date and then
+// draws the list.
+func (c *CommunitiesWidget) Draw() {
+	if time.Since(c.refreshed) > communityRefreshInterval {
+		c.Refresh()
+	}
+	c.List.Draw()
+}
+
+// HandleEvent restricts the history to the selected community on Enter. It
+// should watch the history widget in order to list communities as soon as they
+// are created.
+func (c *CommunitiesWidget) HandleEvent(ev tcell.Event) bool {
+	if _, ok := ev.(widgets.EventCommunityScope); ok {
+		c.Refresh()
+		return false
+	}
+	if event, ok := ev.(*tcell.EventKey); ok && event.Key() == tcell.KeyEnter {
+		var communityID *fields.QualifiedHash
+		if i := c.Selected(); i > 0 && i <= len(c.communities) {
+			communityID = c.communities[i-1].Community.ID()
+		}
+		if err := c.History.ScopeToCommunity(communityID); err != nil {
+			log.Printf("Failed switching community: %v", err)
+		}
+		c.PostEvent(widgets.NewEventShowContent(c))
+		return true
+	}
+	return c.List.HandleEvent(ev)
+}
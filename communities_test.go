@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	forest "git.sr.ht/~whereswaldon/forest-go"
+	"git.sr.ht/~whereswaldon/forest-go/testutil"
+	"git.sr.ht/~whereswaldon/forest-go/twig"
+)
+
+func TestCommunityMetadata(t *testing.T) {
+	identity, signer := testutil.MakeIdentityOrSkip(t)
+	builder := forest.As(identity, signer)
+	for _, description := range []string{"", "  ", "a description", "several words: with punctuation/1"} {
+		metadata, err := communityMetadata(description)
+		if err != nil {
+			t.Fatalf("failed encoding description %q: %v", description, err)
+		}
+		community, err := builder.NewCommunity("name", metadata)
+		if err != nil {
+			t.Fatalf("failed creating community described as %q: %v", description, err)
+		}
+		if err := community.Metadata.Validate(); err != nil {
+			t.Errorf("invalid metadata for description %q: %v", description, err)
+		}
+		decoded := twig.New()
+		if err := decoded.UnmarshalBinary(community.Metadata.Blob); err != nil {
+			t.Fatalf("failed decoding metadata for description %q: %v", description, err)
+		}
+		if got, want := string(decoded.Values[communityDescriptionKey]), strings.TrimSpace(description); got != want {
+			t.Errorf("expected description %q, got %q", want, got)
+		}
+	}
+	if _, err := communityMetadata("nul\x00byte"); err == nil {
+		t.Errorf("expected a description containing a NUL byte to be rejected")
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"git.sr.ht/~whereswaldon/forest-go/grove"
+)
+
+// RunNewCommunityCommand implements `wisteria new-community`, which creates a
+// community signed by the configured identity and adds it to the grove. Any
+// value not given in args is prompted for.
+func RunNewCommunityCommand(args []string, defaultConfigPath, defaultGrovePath string, prompter Prompter, out io.Writer) error {
+	flags := flag.NewFlagSet("new-community", flag.ContinueOnError)
+	configpath := flags.String("config", defaultConfigPath, "the configuration file to load")
+	grovepath := flags.String("grove", defaultGrovePath, "path to the grove to add the community to (directory of arbor history)")
+	description := flags.String("description", "", "a description of the community, saved in its metadata (prompted for if the name is)")
+	nogpg := flags.Bool("nogpg", false, "disable the use of GPG for cryptography even when it is installed")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), `Usage of new-community:
+
+%s new-community [flags] [name]
+
+Creates a community with the given name and switches wisteria to it. A
+running wisteria will find the community in the grove and send it to its
+relays.
+
+`, os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	config := NewConfig()
+	config.GroveDirectory = *grovepath
+	config.ConfigDirectory = filepath.Dir(*configpath)
+	if err := config.LoadFromPath(*configpath); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("no configuration at %s; run wisteria once to create an identity", *configpath)
+		}
+		return fmt.Errorf("failed loading configuration file: %w", err)
+	}
+	config.ChooseGPG(*nogpg)
+
+	name := strings.Join(flags.Args(), " ")
+	var err error
+	if name == "" {
+		if name, err = prompter.PromptLine("Name of the new community:"); err != nil {
+			return fmt.Errorf("failed reading community name: %w", err)
+		}
+		if *description == "" {
+			const withDescription = "Yes, describe it"
+			choice, err := prompter.Choose("Describe the community?", []interface{}{"No", withDescription}, func(i interface{}) string {
+				return i.(string)
+			})
+			if err != nil {
+				return fmt.Errorf("failed choosing whether to describe the community: %w", err)
+			}
+			if choice.(string) == withDescription {
+				if *description, err = prompter.PromptLine("Description of the community:"); err != nil {
+					return fmt.Errorf("failed reading community description: %w", err)
+				}
+			}
+		}
+	}
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("community name cannot be empty")
+	}
+
+	if config.NeedsPassphrase() {
+		wizard := &Wizard{Config: config, Prompter: prompter}
+		prompt := "Please enter your arbor identity passphrase (hit enter when finished):"
+		if err := wizard.ConfigurePassphrase(prompt); err != nil {
+			return fmt.Errorf("failed to get arbor passphrase: %w", err)
+		}
+	}
+
+	groveStore, err := grove.New(*grovepath)
+	if err != nil {
+		return fmt.Errorf("failed opening grove at %s: %w", *grovepath, err)
+	}
+	community, err := CreateCommunity(config, groveStore, name, *description)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Created community %s (%s)\n", string(community.Name.Blob), community.ID())
+
+	state, err := LoadState(config.StatePath())
+	if err != nil {
+		return fmt.Errorf("failed loading saved state: %w", err)
+	}
+	if err := state.Update(func(state *State) bool {
+		state.Community = community.ID().String()
+		return true
+	}); err != nil {
+		return fmt.Errorf("failed saving community choice: %w", err)
+	}
+	return nil
+}
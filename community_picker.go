@@ -0,0 +1,111 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"strings"
+
+	forest "git.sr.ht/~whereswaldon/forest-go"
+	"git.sr.ht/~whereswaldon/forest-go/fields"
+	"git.sr.ht/~whereswaldon/wisteria/widgets"
+	"github.com/gdamore/tcell"
+	"github.com/gdamore/tcell/views"
+)
+
+// CommunityPicker asks the user to choose one of the communities in the store,
+// offering to create a new one as well. It must be added to the Switcher so
+// that it can display itself.
+type CommunityPicker struct {
+	*views.BoxLayout
+	Header  *views.TextBar
+	List    *widgets.List
+	History *HistoryWidget
+
+	communities []*forest.Community
+	// onPick is called with the chosen community
+	onPick func(*forest.Community)
+	views.WidgetWatchers
+}
+
+// NewCommunityPicker creates a picker listing the communities in the history
+// widget's store.
+func NewCommunityPicker(history *HistoryWidget) *CommunityPicker {
+	p := &CommunityPicker{
+		BoxLayout: views.NewBoxLayout(views.Vertical),
+		Header:    views.NewTextBar(),
+		List:      widgets.NewList(),
+		History:   history,
+	}
+	p.Header.SetStyle(tcell.StyleDefault.Reverse(true))
+	p.BoxLayout.Watch(p)
+	p.BoxLayout.AddWidget(p.Header, 0)
+	p.BoxLayout.AddWidget(p.List, 1.0)
+	return p
+}
+
+// Pick displays the picker with the given prompt, selecting the community with
+// the preselected ID if there is one. Once the user chooses a community,
+// onPick is called with it.
+func (p *CommunityPicker) Pick(prompt string, preselected *fields.QualifiedHash, onPick func(*forest.Community)) {
+	nodes, err := p.History.Recent(fields.NodeTypeCommunity, maxListedCommunities)
+	if err != nil {
+		log.Printf("Failed listing communities: %v", err)
+		return
+	}
+	p.communities = make([]*forest.Community, 0, len(nodes))
+	for _, node := range nodes {
+		if community, ok := node.(*forest.Community); ok {
+			p.communities = append(p.communities, community)
+		}
+	}
+	sort.SliceStable(p.communities, func(i, j int) bool {
+		return strings.ToLower(string(p.communities[i].Name.Blob)) < strings.ToLower(string(p.communities[j].Name.Blob))
+	})
+	items := make([]string, 0, len(p.communities)+1)
+	selected := 0
+	for i, community := range p.communities {
+		if preselected != nil && community.ID().Equals(preselected) {
+			selected = i
+		}
+		items = append(items, string(community.Name.Blob))
+	}
+	items = append(items, "+ create a new community")
+	p.List.SetItems(items)
+	p.List.Select(selected)
+	p.Header.SetLeft(prompt+"; Enter to choose, Esc to cancel", tcell.StyleDefault.Reverse(true))
+	p.onPick = onPick
+	p.PostEvent(widgets.NewEventShowWidget(p, p))
+}
+
+// HandleEvent calls the pending onPick with the selected community on Enter,
+// or asks for a new community and calls onPick with it once it is created if
+// that option is selected. Esc cancels.
+func (p *CommunityPicker) HandleEvent(ev tcell.Event) bool {
+	switch event := ev.(type) {
+	case views.EventWidget:
+		p.PostEvent(event)
+		return false
+	case *tcell.EventKey:
+		switch event.Key() {
+		case tcell.KeyEnter:
+			onPick := p.onPick
+			p.onPick = nil
+			p.PostEvent(widgets.NewEventShowContent(p))
+			switch i := p.List.Selected(); {
+			case i >= 0 && i < len(p.communities):
+				if onPick != nil {
+					onPick(p.communities[i])
+				}
+			case i == len(p.communities):
+				p.History.EmitCommunityRequest(onPick)
+			}
+			return true
+		case tcell.KeyEscape:
+			p.onPick = nil
+			p.PostEvent(widgets.NewEventShowContent(p))
+			return true
+		}
+		return p.List.HandleEvent(ev)
+	}
+	return false
+}
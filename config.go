@@ -11,11 +11,15 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
 
 	forest "git.sr.ht/~whereswaldon/forest-go"
 	"git.sr.ht/~whereswaldon/forest-go/fields"
+	"git.sr.ht/~whereswaldon/wisteria/keymap"
+	"git.sr.ht/~whereswaldon/wisteria/notify"
+	"git.sr.ht/~whereswaldon/wisteria/socks"
 	"golang.org/x/crypto/openpgp"
 	"golang.org/x/crypto/ssh/terminal"
 
@@ -41,21 +45,64 @@ type Config struct {
 	UseGPG Tristate
 	// the file name of the user's arbor identity node
 	IdentityID string
+	// other identities that the user can post as. Switching to one of them
+	// replaces the PGPUser, UseGPG, and IdentityID above while wisteria runs.
+	Identities []IdentityProfile `json:",omitempty"`
 	// where to store log and profile data
 	RuntimeDirectory string
 	// where application configuration is stored
 	ConfigDirectory string
 	// where arbor nodes are stored
 	GroveDirectory string
-	// The command to launch an editor for composing new messages
+	// the sprout relays to exchange nodes with
+	Relays []Relay `json:",omitempty"`
+	// The SOCKS5 proxy that relays are dialed through unless they choose
+	// their own, like "socks5://127.0.0.1:9050" for Tor. If empty, relays
+	// are dialed directly.
+	Proxy string `json:",omitempty"`
+	// The command to launch an editor for composing new messages. If empty,
+	// $EDITOR is run within wisteria's own terminal.
 	EditorCmd []string
+	// controls whether EditorCmd runs within wisteria's own terminal while the
+	// TUI is suspended. Legal values are "true", "false", and "" (empty string
+	// runs it in the terminal unless it launches a graphical terminal emulator)
+	EditorInTerminal Tristate
+	// overrides the default key bindings. Each entry maps the name of an action
+	// to the keys that trigger it, written like "Ctrl-C", "g", or the chord "g g".
+	// Listed actions lose their default bindings.
+	Keymap map[string][]string
+	// chooses which arriving messages trigger notifications. By default,
+	// mentions of the user's name and direct replies to the user do.
+	Notifications notify.Settings
+	// the backends that present notifications, among "desktop", "bell",
+	// "osc9", "osc777", "tmux", and "command". If empty, desktop notifications
+	// are used when a graphical display is available and the bell otherwise.
+	Notifiers []string
+	// the command run by the "command" notifier. The placeholders {title},
+	// {body}, and {urgency} within its arguments are replaced.
+	NotifyCommand []string
 
 	// Secure memory enclave where pgp passphrase is stored
 	passphraseEnclave *memguard.Enclave
+	// primary holds the identity configured by PGPUser, UseGPG, and IdentityID
+	// once another has been switched to
+	primary *IdentityProfile
+	// active is the index within IdentityProfiles of the identity in use
+	active int
 }
 
-// NewConfig creates a config that is prepopulated with a runtime directory and an editor command that
-// will work on many Linux systems
+// IdentityProfile holds the settings of an identity that the user can switch to
+// while wisteria runs. Its fields mean the same as those of the Config.
+type IdentityProfile struct {
+	PGPUser    string
+	UseGPG     Tristate
+	IdentityID string
+
+	passphraseEnclave *memguard.Enclave
+}
+
+// NewConfig creates a config that is prepopulated with a runtime directory. By default,
+// new messages are composed by running $EDITOR within wisteria's own terminal.
 func NewConfig() *Config {
 	dir, err := ioutil.TempDir("", "arbor")
 	if err != nil {
@@ -64,7 +111,6 @@ func NewConfig() *Config {
 	}
 	return &Config{
 		RuntimeDirectory: dir,
-		EditorCmd:        []string{"xterm", "-e", os.ExpandEnv("$EDITOR"), "{}"},
 	}
 }
 
@@ -177,15 +223,217 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("PGPUser must be set")
 	case c.IdentityID == "":
 		return fmt.Errorf("Identity must be set")
-	case len(c.EditorCmd) < 2:
+	case len(c.EditorCmd) == 1:
 		return fmt.Errorf("Editor Command %v is impossibly short", c.EditorCmd)
 	}
+	for i, profile := range c.Identities {
+		switch {
+		case profile.IdentityID == "":
+			return fmt.Errorf("Identity must be set for identity %d", i+1)
+		case profile.UseGPG == TristateTrue && profile.PGPUser == "":
+			return fmt.Errorf("PGPUser must be set for identity %s to use GPG", profile.IdentityID)
+		}
+	}
+	relayAddresses := make(map[string]bool)
+	if c.Proxy != "" {
+		if _, err := socks.FromURL(c.Proxy); err != nil {
+			return fmt.Errorf("Proxy is invalid: %w", err)
+		}
+	}
+	for _, relay := range c.Relays {
+		if err := relay.Validate(); err != nil {
+			return fmt.Errorf("Relay is invalid: %w", err)
+		}
+		if relayAddresses[relay.Address] {
+			return fmt.Errorf("Relay %s is listed more than once", relay.Address)
+		}
+		relayAddresses[relay.Address] = true
+	}
+	if err := keymap.Check(AllActions, c.Keymap); err != nil {
+		return fmt.Errorf("Keymap is invalid: %w", err)
+	}
+	if err := notify.Check(c.Notifications); err != nil {
+		return fmt.Errorf("Notifications are invalid: %w", err)
+	}
+	if err := notify.CheckBackends(c.Notifiers, c.notifierOptions()); err != nil {
+		return fmt.Errorf("Notifiers are invalid: %w", err)
+	}
 	return nil
 }
 
+// ChooseGPG decides whether each identity uses GPG when the configuration
+// leaves it undefined, enabling it if GPG is available. If disable is set,
+// GPG is never used.
+func (c *Config) ChooseGPG(disable bool) {
+	choose := func(useGPG *Tristate) {
+		if disable {
+			// disabling it should always win
+			*useGPG = TristateFalse
+		} else if *useGPG == TristateUndefined {
+			// use gpg if it's available and the user hasn't opted out
+			if GPGAvailable() {
+				*useGPG = TristateTrue
+			} else {
+				*useGPG = TristateFalse
+			}
+		}
+	}
+	choose(&c.UseGPG)
+	for i := range c.Identities {
+		choose(&c.Identities[i].UseGPG)
+	}
+}
+
+// NeedsPassphrase reports whether the identity in use signs with a key
+// managed by wisteria whose passphrase has not been entered yet.
+func (c *Config) NeedsPassphrase() bool {
+	usesGPG := c.PGPUser != "" && c.UseGPG == TristateTrue
+	return !usesGPG && c.passphraseEnclave == nil
+}
+
+// IdentityProfiles lists every identity that the user can post as: the one
+// configured by PGPUser, UseGPG, and IdentityID, followed by the Identities.
+// Switching identities does not change the order.
+func (c *Config) IdentityProfiles() []IdentityProfile {
+	profiles := make([]IdentityProfile, 0, len(c.Identities)+1)
+	profiles = append(profiles, *c.profile(0))
+	return append(profiles, c.Identities...)
+}
+
+// ActiveIdentity returns the index within IdentityProfiles of the identity in
+// use.
+func (c *Config) ActiveIdentity() int {
+	return c.active
+}
+
+// profile returns the identity at the given index of IdentityProfiles.
+func (c *Config) profile(index int) *IdentityProfile {
+	if index > 0 {
+		return &c.Identities[index-1]
+	}
+	if c.primary == nil {
+		return &IdentityProfile{
+			PGPUser:           c.PGPUser,
+			UseGPG:            c.UseGPG,
+			IdentityID:        c.IdentityID,
+			passphraseEnclave: c.passphraseEnclave,
+		}
+	}
+	return c.primary
+}
+
+// SwitchIdentity starts using the identity at the given index of
+// IdentityProfiles, remembering the passphrase entered for the identity
+// previously in use.
+func (c *Config) SwitchIdentity(index int) error {
+	if index < 0 || index > len(c.Identities) {
+		return fmt.Errorf("no identity at index %d", index)
+	}
+	if c.primary == nil {
+		c.primary = c.profile(0)
+	}
+	c.profile(c.active).passphraseEnclave = c.passphraseEnclave
+	next := c.profile(index)
+	c.PGPUser = next.PGPUser
+	c.UseGPG = next.UseGPG
+	c.IdentityID = next.IdentityID
+	c.passphraseEnclave = next.passphraseEnclave
+	c.active = index
+	return nil
+}
+
+// Keys returns the key bindings configured by the Keymap.
+func (c *Config) Keys() (*keymap.Keymap, error) {
+	return keymap.New(AllActions, c.Keymap)
+}
+
+// NotificationRules returns the configured notification rules for a user with
+// the given name.
+func (c *Config) NotificationRules(username string) (*notify.Engine, error) {
+	return notify.New(c.Notifications, username)
+}
+
+// NotifierBackends returns the names of the configured notification backends.
+func (c *Config) NotifierBackends() []string {
+	if len(c.Notifiers) == 0 {
+		return notify.DefaultBackends()
+	}
+	return c.Notifiers
+}
+
+// notifierOptions returns the options of the notification backends.
+func (c *Config) notifierOptions() notify.Options {
+	return notify.Options{
+		AppName: "Arbor",
+		Command: c.NotifyCommand,
+	}
+}
+
+// Notifier returns a Notifier that presents notifications through the
+// configured backends.
+func (c *Config) Notifier() (notify.Notifier, error) {
+	return notify.NewNotifier(c.NotifierBackends(), c.notifierOptions())
+}
+
+// graphicalTerminals are terminal emulators that open a window of their own
+// and therefore need a graphical display.
+var graphicalTerminals = map[string]bool{
+	"xterm":          true,
+	"uxterm":         true,
+	"urxvt":          true,
+	"st":             true,
+	"alacritty":      true,
+	"kitty":          true,
+	"foot":           true,
+	"wezterm":        true,
+	"konsole":        true,
+	"gnome-terminal": true,
+	"xfce4-terminal": true,
+	"terminator":     true,
+}
+
+// launchesGraphicalTerminal returns whether the EditorCmd opens a graphical
+// terminal emulator.
+func (c *Config) launchesGraphicalTerminal() bool {
+	return len(c.EditorCmd) > 0 && graphicalTerminals[filepath.Base(c.EditorCmd[0])]
+}
+
+// graphicalDisplayAvailable returns whether a graphical terminal emulator could
+// open a window.
+func graphicalDisplayAvailable() bool {
+	switch runtime.GOOS {
+	case "darwin", "windows":
+		return true
+	}
+	return os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != ""
+}
+
+// TerminalEditorCmd returns the command (with arguments) named by $EDITOR, falling
+// back to vi if it is unset.
+func TerminalEditorCmd() []string {
+	if editor := strings.Fields(os.Getenv("EDITOR")); len(editor) > 0 {
+		return editor
+	}
+	return []string{"vi"}
+}
+
 // EditFile returns an exec.Cmd that will open the provided filename, edit it, and block until the
-// edit is completed.
-func (c *Config) EditFile(filename string) *exec.Cmd {
+// edit is completed. It also returns whether the command must run within wisteria's own terminal.
+// $EDITOR is used in the terminal if no EditorCmd is configured, or if the EditorCmd opens a
+// graphical terminal and there is no display to open it on.
+func (c *Config) EditFile(filename string) (cmd *exec.Cmd, inTerminal bool) {
+	if len(c.EditorCmd) == 0 || (c.launchesGraphicalTerminal() && !graphicalDisplayAvailable()) {
+		editor := append(TerminalEditorCmd(), filename)
+		return exec.Command(editor[0], editor[1:]...), true
+	}
+	switch c.EditorInTerminal {
+	case TristateTrue:
+		inTerminal = true
+	case TristateFalse:
+		inTerminal = false
+	default:
+		inTerminal = !c.launchesGraphicalTerminal()
+	}
 	out := make([]string, 0, len(c.EditorCmd))
 	for _, part := range c.EditorCmd {
 		if part == "{}" {
@@ -194,7 +442,7 @@ func (c *Config) EditFile(filename string) *exec.Cmd {
 			out = append(out, part)
 		}
 	}
-	return exec.Command(out[0], out[1:]...)
+	return exec.Command(out[0], out[1:]...), inTerminal
 }
 
 // KeyRingPath returns where the keyring holding the private key for the provided Identity
@@ -207,6 +455,45 @@ func (c *Config) KeyRingPath(identityID string) string {
 	return keyringPath
 }
 
+// DraftDirectory returns where unfinished replies are saved.
+func (c *Config) DraftDirectory() string {
+	const draftDir = "drafts"
+	return filepath.Join(c.ConfigDirectory, draftDir)
+}
+
+// ReadMarkerPath returns where the record of which replies the configured identity
+// has read is stored. It lives beside the grove (rather than within it, where it
+// would be mistaken for a node) so that it stays with the history it describes.
+func (c *Config) ReadMarkerPath() string {
+	const extension = ".json"
+	readMarkerDir := filepath.Clean(c.GroveDirectory) + "-read"
+	return filepath.Join(readMarkerDir, c.IdentityID+extension)
+}
+
+// StatePath returns where choices made within the TUI are saved between runs.
+func (c *Config) StatePath() string {
+	const stateFile = "state.json"
+	return filepath.Join(c.ConfigDirectory, stateFile)
+}
+
+// PinsPath returns where the certificate fingerprints of relays trusted on
+// first use are saved.
+func (c *Config) PinsPath() string {
+	const pinsFile = "relay-pins.json"
+	return filepath.Join(c.ConfigDirectory, pinsFile)
+}
+
+// SearchIndexDirectory returns where the full-text index of the grove is stored.
+func (c *Config) SearchIndexDirectory() string {
+	return SearchIndexDirectory(c.GroveDirectory)
+}
+
+// SearchIndexDirectory returns where the full-text index of the grove in the given
+// directory is stored. Like the read markers, it lives beside the grove.
+func SearchIndexDirectory(groveDirectory string) string {
+	return filepath.Clean(groveDirectory) + "-index"
+}
+
 // Builder creates a forest.Builder based on the configuration. This allows the client
 // to create nodes on this user's behalf.
 func (c *Config) Builder(store forest.Store) (*forest.Builder, error) {
@@ -455,7 +742,8 @@ type Wizard struct {
 	*Config
 }
 
-// ConfigurePassphrase prompts the user to enter their
+// ConfigurePassphrase prompts the user to enter the passphrase of the identity
+// in use
 func (w *Wizard) ConfigurePassphrase(prompt string) error {
 	// get a passphrase
 	passphrase, err := w.PromptSecure(prompt)
@@ -668,5 +956,34 @@ func (w *Wizard) Run(store forest.Store) error {
 		pgpIds = append(pgpIds, keyID)
 	}
 	w.PGPUser = pgpIds[0]
+	if err := w.ConfigureRelay(); err != nil {
+		return fmt.Errorf("Error configuring relay: %w", err)
+	}
 	return nil
 }
+
+// ConfigureRelay offers to add a first relay to the configuration.
+func (w *Wizard) ConfigureRelay() error {
+	const addRelay = "Connect to a relay"
+	choice, err := w.Choose("Wisteria can fetch and send messages through a sprout relay:", []interface{}{addRelay, "Not now"}, func(i interface{}) string {
+		return i.(string)
+	})
+	if err != nil {
+		return fmt.Errorf("failed choosing whether to add a relay: %w", err)
+	} else if choice.(string) != addRelay {
+		return nil
+	}
+	for {
+		address, err := w.PromptLine("Enter the relay's address (like arbor.example.com:7117):")
+		if err != nil {
+			return fmt.Errorf("failed reading relay address: %w", err)
+		}
+		relay := Relay{Address: address}
+		if err := relay.Validate(); err != nil {
+			w.Display(err.Error())
+			continue
+		}
+		w.Relays = append(w.Relays, relay)
+		return nil
+	}
+}
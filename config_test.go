@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSwitchIdentityKeepsOrder(t *testing.T) {
+	config := &Config{
+		PGPUser:    "primary",
+		IdentityID: "primary-id",
+		Identities: []IdentityProfile{
+			{UseGPG: TristateTrue, PGPUser: "second", IdentityID: "second-id"},
+			{PGPUser: "third", IdentityID: "third-id"},
+		},
+	}
+	order := func() []string {
+		var ids []string
+		for _, profile := range config.IdentityProfiles() {
+			ids = append(ids, profile.IdentityID)
+		}
+		return ids
+	}
+	expected := order()
+	for _, index := range []int{1, 2, 0, 2, 1} {
+		if err := config.SwitchIdentity(index); err != nil {
+			t.Fatalf("failed switching to identity %d: %v", index, err)
+		}
+		if config.ActiveIdentity() != index {
+			t.Errorf("expected identity %d to be active, got %d", index, config.ActiveIdentity())
+		}
+		if config.IdentityID != expected[index] {
+			t.Errorf("expected to post as %s, got %s", expected[index], config.IdentityID)
+		}
+		if (config.UseGPG == TristateTrue) != (index == 1) {
+			t.Errorf("identity %d has the wrong UseGPG setting", index)
+		}
+		for i, id := range order() {
+			if id != expected[i] {
+				t.Fatalf("identities reordered after switching to %d: %v", index, order())
+			}
+		}
+	}
+	if err := config.SwitchIdentity(3); err == nil {
+		t.Errorf("expected switching to a missing identity to fail")
+	}
+}
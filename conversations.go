@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	forest "git.sr.ht/~whereswaldon/forest-go"
+	"git.sr.ht/~whereswaldon/forest-go/fields"
+	"git.sr.ht/~whereswaldon/wisteria/widgets"
+	"github.com/gdamore/tcell"
+)
+
+const (
+	// conversationListWidth is the number of columns occupied by the list of
+	// conversations
+	conversationListWidth = 40
+	// maxListedParticipants is the number of participants named for each
+	// conversation before the rest are summarized as a count
+	maxListedParticipants = 3
+)
+
+// Conversation summarizes a conversation within a community.
+type Conversation struct {
+	Root         *forest.Reply
+	Replies      int
+	Participants []string
+	LastActivity time.Time
+}
+
+// conversationRootID returns the ID of the root of the conversation that the
+// reply belongs to.
+func conversationRootID(reply *forest.Reply) *fields.QualifiedHash {
+	if reply.Depth == 1 {
+		return reply.ID()
+	}
+	return &reply.ConversationID
+}
+
+// ConversationsWidget lists the conversations in the community of the selected
+// message, most recently active first. Selecting one filters the history to it.
+type ConversationsWidget struct {
+	*widgets.List
+	History *HistoryWidget
+
+	// CommunityID identifies the community whose conversations are listed
+	CommunityID   *fields.QualifiedHash
+	conversations []Conversation
+	// listed is the number of replies in the community when the conversations
+	// were last listed
+	listed int
+}
+
+// NewConversationsWidget creates a widget listing the conversations in the
+// history widget's ReplyList. It should watch the history widget in order to
+// follow the selected community.
+func NewConversationsWidget(history *HistoryWidget) *ConversationsWidget {
+	return &ConversationsWidget{
+		List:    widgets.NewList(),
+		History: history,
+	}
+}
+
+// Size returns a fixed width so that the list can sit beside the history.
+func (c *ConversationsWidget) Size() (int, int) {
+	_, height := c.List.Size()
+	return conversationListWidth, height
+}
+
+// communityReplies returns the number of loaded replies in the listed community.
+func (c *ConversationsWidget) communityReplies() int {
+	count := 0
+	if c.CommunityID != nil {
+		c.History.ReplyList.WithCommunityReplies(c.CommunityID, func(replies []*forest.Reply) {
+			count = len(replies)
+		})
+	}
+	return count
+}
+
+// Refresh recomputes the list of conversations from the loaded replies.
+func (c *ConversationsWidget) Refresh() {
+	c.listed = c.communityReplies()
+	c.conversations = nil
+	if c.CommunityID != nil {
+		c.conversations = c.summarize()
+	}
+	items := make([]string, 0, len(c.conversations)+1)
+	for _, conversation := range c.conversations {
+		items = append(items, c.describe(conversation))
+	}
+	if len(items) == 0 {
+		items = append(items, "No conversations loaded")
+	}
+	c.SetItems(items)
+}
+
+// summarize groups the loaded replies in the community by conversation.
+func (c *ConversationsWidget) summarize() []Conversation {
+	byRoot := make(map[string]*Conversation)
+	participants := make(map[string]map[string]struct{})
+	order := []string{}
+	c.History.ReplyList.WithCommunityReplies(c.CommunityID, func(replies []*forest.Reply) {
+		for _, reply := range replies {
+			rootID := conversationRootID(reply)
+			key := rootID.String()
+			conversation, ok := byRoot[key]
+			if !ok {
+				conversation = &Conversation{}
+				byRoot[key] = conversation
+				participants[key] = make(map[string]struct{})
+				order = append(order, key)
+			}
+			if reply.Depth == 1 {
+				conversation.Root = reply
+			} else {
+				conversation.Replies++
+			}
+			if created := reply.Created.Time(); created.After(conversation.LastActivity) {
+				conversation.LastActivity = created
+			}
+			name := reply.Author.String()
+			if author, has, err := c.History.GetIdentity(&reply.Author); err == nil && has {
+				name = string(author.(*forest.Identity).Name.Blob)
+			}
+			if _, seen := participants[key][name]; !seen {
+				participants[key][name] = struct{}{}
+				conversation.Participants = append(conversation.Participants, name)
+			}
+		}
+	})
+	conversations := make([]Conversation, 0, len(order))
+	for _, key := range order {
+		conversation := byRoot[key]
+		if conversation.Root == nil {
+			// the root is older than the loaded history
+			rootID := &fields.QualifiedHash{}
+			if err := rootID.UnmarshalText([]byte(key)); err != nil {
+				log.Printf("Failed parsing conversation root ID %s: %v", key, err)
+				continue
+			}
+			node, has, err := c.History.Get(rootID)
+			if err != nil || !has {
+				continue
+			}
+			root, ok := node.(*forest.Reply)
+			if !ok {
+				continue
+			}
+			conversation.Root = root
+		}
+		conversations = append(conversations, *conversation)
+	}
+	sort.SliceStable(conversations, func(i, j int) bool {
+		return conversations[i].LastActivity.After(conversations[j].LastActivity)
+	})
+	return conversations
+}
+
+// describe renders a summary of the conversation as several lines.
+func (c *ConversationsWidget) describe(conversation Conversation) string {
+	title := []rune(firstLine(string(conversation.Root.Content.Blob)))
+	if len(title) > conversationListWidth-1 {
+		title = append(title[:conversationListWidth-2], '…')
+	}
+	replies := "1 reply"
+	if conversation.Replies != 1 {
+		replies = fmt.Sprintf("%d replies", conversation.Replies)
+	}
+	names := conversation.Participants
+	people := strings.Join(names, ", ")
+	if len(names) > maxListedParticipants {
+		people = fmt.Sprintf("%s +%d", strings.Join(names[:maxListedParticipants], ", "), len(names)-maxListedParticipants)
+	}
+	return fmt.Sprintf("%s\n  %s, %s\n  %s", string(title), replies, timeSince(conversation.LastActivity), people)
+}
+
+// timeSince describes how long ago the given time was in a compact form.
+func timeSince(t time.Time) string {
+	elapsed := time.Since(t)
+	switch {
+	case elapsed < time.Minute:
+		return "just now"
+	case elapsed < time.Hour:
+		return fmt.Sprintf("%dm ago", int(elapsed.Minutes()))
+	case elapsed < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(elapsed.Hours()))
+	case elapsed < 30*24*time.Hour:
+		return fmt.Sprintf("%dd ago", int(elapsed.Hours()/24))
+	}
+	return t.Local().Format("2006-01-02")
+}
+
+// Draw refreshes the list if replies arrived in the community since it was
+// last drawn and then draws it.
+func (c *ConversationsWidget) Draw() {
+	if c.communityReplies() != c.listed {
+		c.Refresh()
+	}
+	c.List.Draw()
+}
+
+// HandleEvent follows the community of the selected message, shows the selected
+// conversation on Enter, and returns focus to the history on Esc.
+func (c *ConversationsWidget) HandleEvent(ev tcell.Event) bool {
+	switch event := ev.(type) {
+	case widgets.EventReplySelected:
+		if c.CommunityID == nil || !c.CommunityID.Equals(&event.Selected.CommunityID) {
+			c.CommunityID = &event.Selected.CommunityID
+			c.Refresh()
+			c.Select(0)
+		}
+		return false
+	case *tcell.EventKey:
+		switch event.Key() {
+		case tcell.KeyEnter:
+			if i := c.Selected(); i >= 0 && i < len(c.conversations) {
+				if err := c.History.ShowConversation(c.conversations[i].Root); err != nil {
+					log.Printf("Failed showing conversation: %v", err)
+				}
+				c.PostEvent(widgets.NewEventShowContent(c))
+			}
+			return true
+		case tcell.KeyEscape:
+			c.PostEvent(widgets.NewEventShowContent(c))
+			return true
+		}
+	}
+	return c.List.HandleEvent(ev)
+}
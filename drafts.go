@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	forest "git.sr.ht/~whereswaldon/forest-go"
+	"git.sr.ht/~whereswaldon/forest-go/fields"
+	"git.sr.ht/~whereswaldon/wisteria/atomicfile"
+	"git.sr.ht/~whereswaldon/wisteria/widgets"
+	"github.com/gdamore/tcell"
+)
+
+// draftExtension is the file extension of saved drafts
+const draftExtension = ".txt"
+
+// Draft is an unfinished reply saved on disk.
+type Draft struct {
+	// ParentID is the ID of the node being replied to
+	ParentID *fields.QualifiedHash
+	Content  string
+	Modified time.Time
+}
+
+// DraftStore persists unfinished replies on disk. Each draft is kept in its own
+// file named for the ID of the node that it replies to, so there is at most one
+// draft per parent node.
+type DraftStore struct {
+	Directory string
+}
+
+// NewDraftStore creates a DraftStore that keeps drafts in the given directory,
+// creating the directory if necessary.
+func NewDraftStore(directory string) (*DraftStore, error) {
+	if err := os.MkdirAll(directory, 0770); err != nil {
+		return nil, fmt.Errorf("failed creating draft directory %s: %w", directory, err)
+	}
+	return &DraftStore{Directory: directory}, nil
+}
+
+// PathFor returns the path of the file holding the draft reply to the given parent.
+func (d *DraftStore) PathFor(parentID *fields.QualifiedHash) string {
+	return filepath.Join(d.Directory, parentID.String()+draftExtension)
+}
+
+// Load returns the draft reply to the given parent and whether there was one.
+func (d *DraftStore) Load(parentID *fields.QualifiedHash) (string, bool, error) {
+	b, err := ioutil.ReadFile(d.PathFor(parentID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("failed reading draft for %s: %w", parentID, err)
+	}
+	return string(b), true, nil
+}
+
+// Save stores the content as the draft reply to the given parent, replacing any
+// existing draft.
+func (d *DraftStore) Save(parentID *fields.QualifiedHash, content string) error {
+	if err := atomicfile.WriteFile(d.PathFor(parentID), []byte(content), 0660); err != nil {
+		return fmt.Errorf("failed saving draft for %s: %w", parentID, err)
+	}
+	return nil
+}
+
+// Delete removes the draft reply to the given parent, if there is one.
+func (d *DraftStore) Delete(parentID *fields.QualifiedHash) error {
+	if err := os.Remove(d.PathFor(parentID)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed deleting draft for %s: %w", parentID, err)
+	}
+	return nil
+}
+
+// List returns every saved draft, most recently modified first.
+func (d *DraftStore) List() ([]Draft, error) {
+	infos, err := ioutil.ReadDir(d.Directory)
+	if err != nil {
+		return nil, fmt.Errorf("failed listing drafts: %w", err)
+	}
+	drafts := []Draft{}
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasSuffix(name, draftExtension) {
+			continue
+		}
+		parentID := &fields.QualifiedHash{}
+		if err := parentID.UnmarshalText([]byte(strings.TrimSuffix(name, draftExtension))); err != nil {
+			log.Printf("Ignoring unrecognized draft file %s: %v", name, err)
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join(d.Directory, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed reading draft %s: %w", name, err)
+		}
+		drafts = append(drafts, Draft{
+			ParentID: parentID,
+			Content:  string(content),
+			Modified: info.ModTime(),
+		})
+	}
+	sort.Slice(drafts, func(i, j int) bool {
+		return drafts[i].Modified.After(drafts[j].Modified)
+	})
+	return drafts, nil
+}
+
+// modified returns the last time that a draft was added or removed.
+func (d *DraftStore) modified() time.Time {
+	info, err := os.Stat(d.Directory)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// DraftsWidget lists the saved drafts and allows resuming or deleting them.
+type DraftsWidget struct {
+	*widgets.List
+	Drafts  *DraftStore
+	History *HistoryWidget
+
+	drafts []Draft
+	// listed is the modification time of the draft directory when the drafts
+	// were last listed
+	listed time.Time
+}
+
+// NewDraftsWidget creates a widget listing the drafts in the history widget's
+// DraftStore.
+func NewDraftsWidget(history *HistoryWidget) *DraftsWidget {
+	d := &DraftsWidget{
+		List:    widgets.NewList(),
+		Drafts:  history.Drafts,
+		History: history,
+	}
+	d.Refresh()
+	return d
+}
+
+// Refresh reloads the list of drafts from disk.
+func (d *DraftsWidget) Refresh() {
+	d.listed = d.Drafts.modified()
+	drafts, err := d.Drafts.List()
+	if err != nil {
+		log.Printf("Failed listing drafts: %v", err)
+		return
+	}
+	d.drafts = drafts
+	items := make([]string, 0, len(drafts)+1)
+	for _, draft := range drafts {
+		items = append(items, fmt.Sprintf("%s  %s: %s", draft.Modified.Local().Format(time.Stamp), d.describeParent(draft.ParentID), firstLine(stripCommentLines(draft.Content))))
+	}
+	if len(items) == 0 {
+		items = append(items, "No drafts. Press Esc while replying to save one.")
+	}
+	d.SetItems(items)
+}
+
+// describeParent summarizes the node being replied to.
+func (d *DraftsWidget) describeParent(parentID *fields.QualifiedHash) string {
+	node, has, err := d.History.Get(parentID)
+	if err != nil || !has {
+		return "reply to unknown message"
+	}
+	switch n := node.(type) {
+	case *forest.Community:
+		return "new conversation in " + string(n.Name.Blob)
+	case *forest.Reply:
+		return "reply to " + firstLine(string(n.Content.Blob))
+	}
+	return "reply to " + parentID.String()
+}
+
+// firstLine returns the first non-empty line of the input.
+func firstLine(input string) string {
+	for _, line := range strings.Split(input, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// selected returns the currently-selected draft, if any.
+func (d *DraftsWidget) selected() (Draft, bool) {
+	i := d.Selected()
+	if i < 0 || i >= len(d.drafts) {
+		return Draft{}, false
+	}
+	return d.drafts[i], true
+}
+
+// Draw refreshes the list if drafts were added or removed since it was last
+// drawn and then draws it.
+func (d *DraftsWidget) Draw() {
+	if d.Drafts.modified() != d.listed {
+		d.Refresh()
+	}
+	d.List.Draw()
+}
+
+// HandleEvent resumes the selected draft on Enter (or in the external editor
+// on e) and deletes it on d.
+func (d *DraftsWidget) HandleEvent(ev tcell.Event) bool {
+	if keyEvent, ok := ev.(*tcell.EventKey); ok {
+		draft, ok := d.selected()
+		switch {
+		case !ok:
+		case keyEvent.Key() == tcell.KeyEnter:
+			d.resume(draft, false)
+			return true
+		case keyEvent.Key() == tcell.KeyRune && keyEvent.Rune() == 'e':
+			d.resume(draft, true)
+			return true
+		case keyEvent.Key() == tcell.KeyRune && keyEvent.Rune() == 'd':
+			if err := d.Drafts.Delete(draft.ParentID); err != nil {
+				log.Printf("Failed deleting draft: %v", err)
+			}
+			d.Refresh()
+			return true
+		}
+	}
+	return d.List.HandleEvent(ev)
+}
+
+// resume returns to the history and continues editing the draft, either
+// inline or in the external editor.
+func (d *DraftsWidget) resume(draft Draft, external bool) {
+	parent, has, err := d.History.Get(draft.ParentID)
+	if err != nil {
+		log.Printf("Failed looking up parent of draft: %v", err)
+		return
+	} else if !has {
+		log.Printf("Cannot resume draft, %s is not in the store", draft.ParentID)
+		return
+	}
+	d.PostEvent(widgets.NewEventShowContent(d))
+	if external {
+		if err := d.History.StartNewNode(parent, ""); err != nil {
+			log.Printf("Failed resuming draft: %v", err)
+		}
+		return
+	}
+	d.History.EmitEditorRequest(parent)
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"log"
+	"math"
+	"sort"
 
 	forest "git.sr.ht/~whereswaldon/forest-go"
 	"git.sr.ht/~whereswaldon/forest-go/fields"
@@ -17,6 +19,9 @@ type RenderedLine struct {
 	ID    *fields.QualifiedHash
 	Style tcell.Style
 	Text  []rune
+	// Text[Start:End] is the author name or line of content that the line
+	// displays, without any tree guides or markers around it
+	Start, End int
 }
 
 // HistoryView models the visible contents of the chat history. It implements tcell.CellModel
@@ -24,8 +29,35 @@ type HistoryView struct {
 	*replylist.ReplyList
 	store.ExtendedStore
 	FilterID, SelectedReplyID *fields.QualifiedHash
-	rendered                  []RenderedLine
-	Cursor                    struct {
+	// CommunityID restricts the view to the replies within a single community
+	// if it is set
+	CommunityID *fields.QualifiedHash
+	// Threaded controls whether replies are laid out as an indented tree
+	// beneath their parents rather than as a flat list ordered by creation time
+	Threaded bool
+	// LoadingOlder indicates that older history is being loaded, and causes a
+	// marker to be displayed above the oldest message
+	LoadingOlder bool
+	// Unread records which replies have been read. Unread replies are emphasized
+	// if it is set.
+	Unread *ReadMarkers
+	// unread holds the IDs of the unread replies in the ReplyList, or is nil
+	// if they have not been counted
+	unread map[string]struct{}
+	// Search highlights the text that it matches if it is set
+	Search *Search
+	// highlights caches the matches of the Search within each rendered line
+	highlights map[int][]span
+	rendered   []RenderedLine
+	// nodes holds the displayed nodes in the order that they are displayed
+	nodes []*renderedNode
+	// cache holds the latest rendering of every node by ID
+	cache map[string]*renderedNode
+	// states holds the render state of every node related to the current one
+	states     map[string]nodeState
+	generation int
+	width      int
+	Cursor     struct {
 		X, Y int
 	}
 }
@@ -43,7 +75,7 @@ func (v *HistoryView) CurrentID() *fields.QualifiedHash {
 // UpdateCurrentID recomputes the currently-selected message id based on the
 // current position of the cursor.
 func (v *HistoryView) UpdateCurrentID() {
-	v.ReplyList.WithReplies(func(replies []*forest.Reply) {
+	v.withScopedReplies(0, func(replies []*forest.Reply) {
 		if len(v.rendered) > v.Cursor.Y && v.Cursor.Y > -1 {
 			v.SelectedReplyID = v.rendered[v.Cursor.Y].ID
 		} else if len(replies) > 0 {
@@ -54,6 +86,21 @@ func (v *HistoryView) UpdateCurrentID() {
 	})
 }
 
+// withScopedReplies executes the closure with access to the replies created
+// since the given time within the community that the view is restricted to, or
+// within every community if it is not restricted. The closure must not modify
+// the slice that it is given.
+func (v *HistoryView) withScopedReplies(since fields.Timestamp, closure func(replies []*forest.Reply)) {
+	if v.CommunityID != nil {
+		v.ReplyList.WithCommunityRepliesBetween(v.CommunityID, since, endOfTime, closure)
+		return
+	}
+	v.ReplyList.WithRepliesBetween(since, endOfTime, closure)
+}
+
+// endOfTime is later than the creation time of any reply
+const endOfTime = fields.Timestamp(math.MaxUint64)
+
 // CurrentReply returns the currently-selected node
 func (v *HistoryView) CurrentReply() (*forest.Reply, error) {
 	node, has, err := v.Get(v.CurrentID())
@@ -69,20 +116,31 @@ func (v *HistoryView) CurrentReply() (*forest.Reply, error) {
 
 }
 
+// renderedNode caches the rendered lines of a single node along with the
+// configuration that they were rendered with.
+type renderedNode struct {
+	reply  *forest.Reply
+	config renderConfig
+	lines  []RenderedLine
+	// start is the index of the node's first line within the view
+	start int
+	// generation matches the view's generation if the node is part of the
+	// current layout
+	generation int
+}
+
 // Render recomputes the contents of this view, taking any changes in the nodes in the underlying
-// Archive and position of the cursor into account.
+// Archive and position of the cursor into account. Nodes whose render configuration has not
+// changed since they were last rendered reuse their cached lines.
 func (v *HistoryView) Render() error {
 	currentID := v.CurrentID()
-	v.rendered = []RenderedLine{}
-	ancestry, err := v.AncestryOf(currentID)
+	states, err := v.statesFor(currentID)
 	if err != nil {
-		return fmt.Errorf("failed looking up ancestry of %s: %w", currentID.String(), err)
-	}
-	descendants, err := v.DescendantsOf(currentID)
-	if err != nil {
-		return fmt.Errorf("failed looking up descendants of %s: %w", currentID.String(), err)
+		return err
 	}
 	excludeMap := make(map[string]struct{})
+	// since is the creation time of the oldest reply that may be displayed
+	since := fields.Timestamp(0)
 	if v.FilterID != nil {
 		filterAncestry, err := v.AncestryOf(v.FilterID)
 		if err != nil {
@@ -93,71 +151,493 @@ func (v *HistoryView) Render() error {
 			return fmt.Errorf("failed lookup up descendants of filter node %s: %w", v.FilterID, err)
 		}
 		excludeMap[v.FilterID.String()] = struct{}{}
-		for _, id := range append(filterAncestry, filterDescendants...) {
+		since = endOfTime
+		for _, id := range append(append(filterAncestry, filterDescendants...), v.FilterID) {
 			excludeMap[id.String()] = struct{}{}
+			if reply, ok := v.ReplyList.Lookup(id); ok && reply.Created < since {
+				since = reply.Created
+			}
 		}
 	}
-	v.ReplyList.WithReplies(func(replies []*forest.Reply) {
-		for _, n := range replies {
+	v.states = states
+	v.generation++
+	v.nodes = v.nodes[:0]
+	v.rendered = []RenderedLine{}
+	v.highlights = nil
+	v.width = 0
+	v.withScopedReplies(since, func(replies []*forest.Reply) {
+		var guides []treeGuides
+		if v.Threaded {
+			replies, guides = threadOrder(replies)
+		}
+		for i, n := range replies {
 			if v.FilterID != nil {
 				if _, matchesFilter := excludeMap[n.ID().String()]; !matchesFilter {
 					// skip nodes that don't match current filter
 					continue
 				}
 			}
-			config := renderConfig{}
-			if n.ID().Equals(currentID) {
-				config.state = current
-			} else if in(n.ID(), ancestry) {
-				config.state = ancestor
-			} else if in(n.ID(), descendants) {
-				config.state = descendant
+			config := renderConfig{
+				state:  states[n.ID().String()],
+				unread: v.isUnread(n),
+			}
+			if guides != nil {
+				config.guides = guides[i]
 			}
-			lines, err := renderNode(n, v.ExtendedStore, config)
+			node, err := v.renderCached(n, config)
 			if err != nil {
 				log.Printf("failed rendering %s: %v", n.ID().String(), err)
 				continue
 			}
-			v.rendered = append(v.rendered, lines...)
+			node.start = len(v.rendered)
+			node.generation = v.generation
+			v.nodes = append(v.nodes, node)
+			v.rendered = append(v.rendered, node.lines...)
+			v.measure(node.lines)
 		}
 	})
+	if v.LoadingOlder && len(v.nodes) > 0 {
+		marker := RenderedLine{
+			ID:    v.nodes[0].reply.ID(),
+			Style: tcell.StyleDefault.Dim(true),
+			Text:  []rune(loadingOlderMarker),
+		}
+		v.rendered = append([]RenderedLine{marker}, v.rendered...)
+		for _, node := range v.nodes {
+			node.start++
+		}
+		v.measure(v.rendered[:1])
+	}
 	return nil
 }
 
+const loadingOlderMarker = "--- loading older messages ---"
+
+// LineOf returns the index of the first rendered line of the node with the
+// given ID, or -1 if that node is not displayed.
+func (v *HistoryView) LineOf(id *fields.QualifiedHash) int {
+	if id == nil {
+		return -1
+	}
+	node, ok := v.cache[id.String()]
+	if !ok || node.generation != v.generation {
+		return -1
+	}
+	return node.start
+}
+
+// renderCached returns the rendering of `reply` with the given configuration, reusing
+// the cached rendering if its configuration matches.
+func (v *HistoryView) renderCached(reply *forest.Reply, config renderConfig) (*renderedNode, error) {
+	if v.cache == nil {
+		v.cache = make(map[string]*renderedNode)
+	}
+	node, cached := v.cache[reply.ID().String()]
+	if cached && node.config == config {
+		return node, nil
+	}
+	lines, err := renderNode(reply, v.ExtendedStore, config)
+	if err != nil {
+		return nil, err
+	}
+	if !cached {
+		node = &renderedNode{reply: reply}
+		v.cache[reply.ID().String()] = node
+	}
+	node.config = config
+	node.lines = lines
+	return node, nil
+}
+
+// statesFor computes the render state of every node related to the node
+// with the given ID. Unrelated nodes are absent from the returned map.
+func (v *HistoryView) statesFor(currentID *fields.QualifiedHash) (map[string]nodeState, error) {
+	ancestry, err := v.AncestryOf(currentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed looking up ancestry of %s: %w", currentID.String(), err)
+	}
+	descendants, err := v.DescendantsOf(currentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed looking up descendants of %s: %w", currentID.String(), err)
+	}
+	states := make(map[string]nodeState, len(ancestry)+len(descendants)+1)
+	for _, id := range descendants {
+		states[id.String()] = descendant
+	}
+	for _, id := range ancestry {
+		states[id.String()] = ancestor
+	}
+	states[currentID.String()] = current
+	return states, nil
+}
+
+// measure widens the view to fit the given lines if necessary.
+func (v *HistoryView) measure(lines []RenderedLine) {
+	for _, line := range lines {
+		if len(line.Text) > v.width {
+			v.width = len(line.Text)
+		}
+	}
+}
+
+// restyle updates the styling of the nodes whose render state changed
+// because a different node was selected. All other lines are left untouched.
+func (v *HistoryView) restyle() error {
+	states, err := v.statesFor(v.CurrentID())
+	if err != nil {
+		return err
+	}
+	changed := make(map[string]struct{})
+	for id, state := range v.states {
+		if states[id] != state {
+			changed[id] = struct{}{}
+		}
+	}
+	for id, state := range states {
+		if v.states[id] != state {
+			changed[id] = struct{}{}
+		}
+	}
+	v.states = states
+	return v.rerender(changed)
+}
+
+// rerender re-renders the displayed nodes with the given IDs to reflect their
+// current render state and read status, patching their lines in place.
+func (v *HistoryView) rerender(ids map[string]struct{}) error {
+	for id := range ids {
+		node, ok := v.cache[id]
+		if !ok || node.generation != v.generation {
+			// not currently displayed
+			continue
+		}
+		config := node.config
+		config.state = v.states[id]
+		config.unread = v.isUnread(node.reply)
+		lines, err := renderNode(node.reply, v.ExtendedStore, config)
+		if err != nil {
+			log.Printf("failed restyling %s: %v", id, err)
+			continue
+		}
+		if len(lines) != len(node.lines) {
+			// the layout changed, so patching in place isn't possible
+			return v.Render()
+		}
+		node.config = config
+		node.lines = lines
+		copy(v.rendered[node.start:], lines)
+		v.highlights = nil
+	}
+	return nil
+}
+
+// InsertReply adds a newly-arrived reply to the view. In the flat layout without a
+// filter, only the new reply is rendered and its lines are spliced into place.
+// Otherwise the layout is recomputed, reusing the cached lines of unchanged nodes.
+// The cursor stays on the same message.
+func (v *HistoryView) InsertReply(reply *forest.Reply) error {
+	if v.unread != nil && v.isUnread(reply) {
+		v.unread[reply.ID().String()] = struct{}{}
+	}
+	if node, ok := v.cache[reply.ID().String()]; ok && node.generation == v.generation {
+		return nil
+	}
+	if v.CommunityID != nil && !v.CommunityID.Equals(&reply.CommunityID) {
+		// not displayed
+		return nil
+	}
+	if v.Threaded || v.FilterID != nil || v.states == nil || len(v.nodes) == 0 {
+		return v.Render()
+	}
+	state := none
+	switch v.states[reply.ParentID().String()] {
+	case current, descendant:
+		state = descendant
+	}
+	node, err := v.renderCached(reply, renderConfig{state: state, unread: v.isUnread(reply)})
+	if err != nil {
+		return fmt.Errorf("failed rendering %s: %w", reply.ID().String(), err)
+	}
+	if state != none {
+		v.states[reply.ID().String()] = state
+	}
+	position := sort.Search(len(v.nodes), func(i int) bool {
+		return v.nodes[i].reply.Created > reply.Created
+	})
+	node.start = len(v.rendered)
+	if position < len(v.nodes) {
+		node.start = v.nodes[position].start
+	}
+	node.generation = v.generation
+	v.nodes = append(v.nodes, nil)
+	copy(v.nodes[position+1:], v.nodes[position:])
+	v.nodes[position] = node
+	for _, later := range v.nodes[position+1:] {
+		later.start += len(node.lines)
+	}
+	v.rendered = append(v.rendered, node.lines...)
+	copy(v.rendered[node.start+len(node.lines):], v.rendered[node.start:len(v.rendered)-len(node.lines)])
+	copy(v.rendered[node.start:], node.lines)
+	if v.LoadingOlder && position == 0 {
+		// the marker above the oldest message belongs to it
+		v.rendered[0].ID = reply.ID()
+	}
+	v.measure(node.lines)
+	v.highlights = nil
+	if node.start <= v.Cursor.Y {
+		v.Cursor.Y += len(node.lines)
+	}
+	return nil
+}
+
+// isUnread returns whether the reply should be displayed as unread.
+func (v *HistoryView) isUnread(reply *forest.Reply) bool {
+	return v.Unread != nil && !v.Unread.IsRead(reply)
+}
+
+// MarkRead records that the reply has been read and updates its styling.
+func (v *HistoryView) MarkRead(reply *forest.Reply) error {
+	if v.Unread == nil || !v.Unread.MarkRead(reply) {
+		return nil
+	}
+	delete(v.unread, reply.ID().String())
+	return v.rerender(map[string]struct{}{reply.ID().String(): {}})
+}
+
+// UnreadCount returns the number of unread replies in the ReplyList. The
+// replies are only counted the first time; afterward InsertReply and MarkRead
+// keep the count up to date.
+func (v *HistoryView) UnreadCount() int {
+	if v.unread == nil {
+		v.unread = make(map[string]struct{})
+		if v.Unread == nil {
+			return 0
+		}
+		// every reply created before ReadBefore has been read
+		v.ReplyList.WithRepliesBetween(v.Unread.ReadBefore, endOfTime, func(replies []*forest.Reply) {
+			for _, reply := range replies {
+				if v.isUnread(reply) {
+					v.unread[reply.ID().String()] = struct{}{}
+				}
+			}
+		})
+	}
+	return len(v.unread)
+}
+
+// RecountUnread makes UnreadCount count the unread replies again, which is
+// needed after replies are added to the ReplyList without InsertReply or the
+// read markers are replaced.
+func (v *HistoryView) RecountUnread() {
+	v.unread = nil
+}
+
+// SelectUnread moves the cursor to the first line of the nearest displayed
+// unread reply after (or before, if forward is false) the current one. It
+// returns whether there was such a reply.
+func (v *HistoryView) SelectUnread(forward bool) bool {
+	current := v.LineOf(v.CurrentID())
+	var target *renderedNode
+	for _, node := range v.nodes {
+		if !node.config.unread {
+			continue
+		}
+		if forward && node.start > current {
+			target = node
+			break
+		}
+		if !forward && node.start < current {
+			target = node
+		}
+	}
+	if target == nil {
+		return false
+	}
+	v.SetCursor(v.Cursor.X, target.start)
+	return true
+}
+
+// treeGuides holds the branch guides drawn before a node's lines in the
+// threaded layout.
+type treeGuides struct {
+	first, rest string
+}
+
+// threadOrder arranges replies depth-first beneath their parents, with siblings
+// kept in the order that they appear in `replies`. Replies whose parents are not
+// present are treated as roots. It returns the replies in display order along
+// with the guides to draw for each of them.
+func threadOrder(replies []*forest.Reply) ([]*forest.Reply, []treeGuides) {
+	present := make(map[string]struct{}, len(replies))
+	for _, n := range replies {
+		present[n.ID().String()] = struct{}{}
+	}
+	children := make(map[string][]*forest.Reply)
+	roots := []*forest.Reply{}
+	for _, n := range replies {
+		parent := n.ParentID().String()
+		if _, ok := present[parent]; ok {
+			children[parent] = append(children[parent], n)
+		} else {
+			roots = append(roots, n)
+		}
+	}
+	ordered := make([]*forest.Reply, 0, len(replies))
+	guides := make([]treeGuides, 0, len(replies))
+	var walk func(parent *forest.Reply, indent string)
+	walk = func(parent *forest.Reply, indent string) {
+		kids := children[parent.ID().String()]
+		for i, kid := range kids {
+			guide := treeGuides{first: indent + "├─ ", rest: indent + "│  "}
+			if i == len(kids)-1 {
+				guide = treeGuides{first: indent + "└─ ", rest: indent + "   "}
+			}
+			ordered = append(ordered, kid)
+			guides = append(guides, guide)
+			walk(kid, guide.rest)
+		}
+	}
+	for _, root := range roots {
+		ordered = append(ordered, root)
+		guides = append(guides, treeGuides{})
+		walk(root, "")
+	}
+	return ordered, guides
+}
+
 // GetCell returns the contents of a single cell of the view
 func (v *HistoryView) GetCell(x, y int) (cell rune, style tcell.Style, combining []rune, width int) {
 	cell, style, combining, width = ' ', tcell.StyleDefault, nil, 1
 	if y < len(v.rendered) && x < len(v.rendered[y].Text) {
 		cell, style, combining, width = v.rendered[y].Text[x], v.rendered[y].Style, nil, 1
 	}
+	if v.highlighted(x, y) {
+		style = style.Background(tcell.ColorYellow).Foreground(tcell.ColorBlack)
+	}
 	if v.Cursor.X == x && v.Cursor.Y == y {
 		style = tcell.StyleDefault.Reverse(true)
 	}
 	return
 }
 
-// GetBounds returns the dimensions of the view
-func (v *HistoryView) GetBounds() (int, int) {
-	width := 0
-	for _, line := range v.rendered {
-		if len(line.Text) > width {
-			width = len(line.Text)
+// highlighted returns whether the cell at the given position is part of a
+// match for the current Search.
+func (v *HistoryView) highlighted(x, y int) bool {
+	if v.Search == nil || y < 0 || y >= len(v.rendered) {
+		return false
+	}
+	if v.highlights == nil {
+		v.highlights = make(map[int][]span)
+	}
+	spans, ok := v.highlights[y]
+	if !ok {
+		line := v.rendered[y]
+		spans = v.Search.spans(line.Text[line.Start:line.End])
+		for i := range spans {
+			spans[i].start += line.Start
+			spans[i].end += line.Start
+		}
+		v.highlights[y] = spans
+	}
+	for _, s := range spans {
+		if x >= s.start && x < s.end {
+			return true
+		}
+	}
+	return false
+}
+
+// SetSearch highlights the matches of the given Search, or clears the highlighting
+// if it is nil.
+func (v *HistoryView) SetSearch(search *Search) {
+	v.Search = search
+	v.highlights = nil
+}
+
+// replyMatches returns whether the content or author name of the reply match the
+// current Search.
+func (v *HistoryView) replyMatches(reply *forest.Reply) bool {
+	texts := []string{string(reply.Content.Blob)}
+	if author, has, err := v.GetIdentity(&reply.Author); err == nil && has {
+		texts = append(texts, string(author.(*forest.Identity).Name.Blob))
+	}
+	return v.Search.Matches(texts...)
+}
+
+// SearchMatches returns the number of displayed replies that match the current Search.
+func (v *HistoryView) SearchMatches() int {
+	if v.Search == nil {
+		return 0
+	}
+	count := 0
+	for _, node := range v.nodes {
+		if v.replyMatches(node.reply) {
+			count++
+		}
+	}
+	return count
+}
+
+// SelectMatch moves the cursor to the first line of the nearest displayed reply
+// above (or below, if older is false) the current one that matches the current
+// Search, wrapping around at the ends of the history. It returns whether there
+// was such a reply and whether the search wrapped.
+func (v *HistoryView) SelectMatch(older bool) (found, wrapped bool) {
+	if v.Search == nil || len(v.nodes) == 0 {
+		return false, false
+	}
+	current := sort.Search(len(v.nodes), func(i int) bool {
+		return v.nodes[i].start > v.Cursor.Y
+	}) - 1
+	step := 1
+	if older {
+		step = -1
+	}
+	for i := 1; i <= len(v.nodes); i++ {
+		position := current + step*i
+		if position < 0 || position >= len(v.nodes) {
+			wrapped = true
+			position = (position%len(v.nodes) + len(v.nodes)) % len(v.nodes)
+		}
+		if node := v.nodes[position]; v.replyMatches(node.reply) {
+			v.SetCursor(v.Cursor.X, node.start)
+			return true, wrapped
 		}
 	}
+	return false, false
+}
+
+// Empty reports whether there are no messages to show.
+func (v *HistoryView) Empty() bool {
+	return len(v.rendered) == 0
+}
+
+// GetBounds returns the dimensions of the view
+func (v *HistoryView) GetBounds() (int, int) {
 	height := len(v.rendered) + MaxEmptyVisibleLines
-	return width, height
+	return v.width, height
 }
 
 // SetCursor warps the cursor to the given coordinates
 func (v *HistoryView) SetCursor(x, y int) {
 	v.Cursor.X = x
 	v.Cursor.Y = y
-	v.UpdateCurrentID()
-	if err := v.Render(); err != nil {
+	if err := v.updateSelection(); err != nil {
 		log.Println("Error rendering after SetCursor():", err)
 	}
 }
 
+// updateSelection recomputes the selected node from the cursor position and
+// restyles the view if the selection changed.
+func (v *HistoryView) updateSelection() error {
+	previous := v.SelectedReplyID
+	v.UpdateCurrentID()
+	if previous != nil && v.SelectedReplyID != nil && previous.Equals(v.SelectedReplyID) {
+		return nil
+	}
+	return v.restyle()
+}
+
 // GetCursor returns the position of the cursor, whether it is enabled, and whether it is hidden
 func (v *HistoryView) GetCursor() (int, int, bool, bool) {
 	return v.Cursor.X, v.Cursor.Y, true, false
@@ -182,8 +662,7 @@ func (v *HistoryView) MoveCursor(offx, offy int) {
 			v.Cursor.Y = h - 1
 		}
 	}
-	v.UpdateCurrentID()
-	if err := v.Render(); err != nil {
+	if err := v.updateSelection(); err != nil {
 		log.Printf("Error during post-cursor move render: %v", err)
 	}
 }
@@ -206,20 +685,46 @@ func (v *HistoryView) moveCursorToSelected() {
 		log.Printf("Error during first post-clear render: %v", err)
 	}
 	y := 0
-	for i, renderedLine := range v.rendered {
-		if renderedLine.ID.Equals(v.SelectedReplyID) {
-			y = i
-		}
+	if start := v.LineOf(v.SelectedReplyID); start >= 0 {
+		y = start + len(v.cache[v.SelectedReplyID.String()].lines) - 1
 	}
 	v.SetCursor(v.Cursor.X, y)
 }
 
+// FilterOn restricts the view to the ancestry and descendants of the node with
+// the given ID and selects that node.
+func (v *HistoryView) FilterOn(id *fields.QualifiedHash) {
+	v.FilterID = id
+	v.SelectedReplyID = id
+	v.moveCursorToSelected()
+}
+
+// ScopeTo restricts the view to the community with the given ID, or shows every
+// community if it is nil. Any filter is cleared and the newest message is selected.
+func (v *HistoryView) ScopeTo(communityID *fields.QualifiedHash) error {
+	v.CommunityID = communityID
+	v.FilterID = nil
+	v.SelectedReplyID = nil
+	if err := v.Render(); err != nil {
+		return err
+	}
+	v.SelectLastLine()
+	return nil
+}
+
 // ClearFilter erases the filter on the view to show all nodes again.
 func (v *HistoryView) ClearFilter() {
 	v.FilterID = nil
 	v.moveCursorToSelected()
 }
 
+// ToggleThreaded switches between the flat and threaded layouts, keeping the
+// currently-selected message under the cursor.
+func (v *HistoryView) ToggleThreaded() {
+	v.Threaded = !v.Threaded
+	v.moveCursorToSelected()
+}
+
 // ToggleFilter clears any filter that is set, but sets the current message
 // to be the filter if there is no current filter set.
 func (v *HistoryView) ToggleFilter() {
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	forest "git.sr.ht/~whereswaldon/forest-go"
+	"git.sr.ht/~whereswaldon/forest-go/store"
+	"git.sr.ht/~whereswaldon/forest-go/testutil"
+	"git.sr.ht/~whereswaldon/wisteria/replylist"
+)
+
+// viewGrove holds a community and a store that the nodes created within it
+// are added to.
+type viewGrove struct {
+	builder   *forest.Builder
+	community *forest.Community
+	store     *store.Archive
+}
+
+func newViewGrove(t *testing.T) *viewGrove {
+	identity, signer, community := testutil.MakeCommunityOrSkip(t)
+	g := &viewGrove{
+		builder:   forest.As(identity, signer),
+		community: community,
+		store:     store.NewArchive(store.NewMemoryStore()),
+	}
+	for _, node := range []forest.Node{identity, community} {
+		if err := g.store.Add(node); err != nil {
+			t.Fatalf("failed storing node: %v", err)
+		}
+	}
+	return g
+}
+
+// reply creates a reply to the parent, or a new conversation if the parent is
+// nil, and adds it to the store. Replies are created at least a millisecond
+// apart so that they are ordered.
+func (g *viewGrove) reply(t *testing.T, parent forest.Node, content string) *forest.Reply {
+	time.Sleep(2 * time.Millisecond)
+	if parent == nil {
+		parent = g.community
+	}
+	reply, err := g.builder.NewReply(parent, content, []byte{})
+	if err != nil {
+		t.Fatalf("failed creating reply: %v", err)
+	}
+	if err := g.store.Add(reply); err != nil {
+		t.Fatalf("failed storing reply: %v", err)
+	}
+	return reply
+}
+
+// view creates a rendered view of the replies.
+func (g *viewGrove) view(t *testing.T, replies ...*forest.Reply) *HistoryView {
+	list := new(replylist.ReplyList)
+	list.AddReplies(replies...)
+	v := &HistoryView{ReplyList: list, ExtendedStore: g.store}
+	if err := v.Render(); err != nil {
+		t.Fatalf("failed rendering: %v", err)
+	}
+	return v
+}
+
+// expectFreshRender checks that the view displays exactly what a fresh
+// rendering of the same replies with the same selection would.
+func expectFreshRender(t *testing.T, v *HistoryView, replies []*forest.Reply) {
+	t.Helper()
+	fresh := &HistoryView{
+		ReplyList:       v.ReplyList,
+		ExtendedStore:   v.ExtendedStore,
+		SelectedReplyID: v.SelectedReplyID,
+		FilterID:        v.FilterID,
+		CommunityID:     v.CommunityID,
+		LoadingOlder:    v.LoadingOlder,
+	}
+	if err := fresh.Render(); err != nil {
+		t.Fatalf("failed rendering: %v", err)
+	}
+	if len(v.rendered) != len(fresh.rendered) {
+		t.Fatalf("expected %d lines, got %d", len(fresh.rendered), len(v.rendered))
+	}
+	for i, expected := range fresh.rendered {
+		line := v.rendered[i]
+		if string(line.Text) != string(expected.Text) || line.Style != expected.Style ||
+			!line.ID.Equals(expected.ID) || line.Start != expected.Start || line.End != expected.End {
+			t.Errorf("line %d is %q, expected %q", i, string(line.Text), string(expected.Text))
+		}
+	}
+	for _, reply := range replies {
+		if line, expected := v.LineOf(reply.ID()), fresh.LineOf(reply.ID()); line != expected {
+			t.Errorf("expected %q to start on line %d, got %d", string(reply.Content.Blob), expected, line)
+		}
+	}
+}
+
+func TestInsertReply(t *testing.T) {
+	for _, loadingOlder := range []bool{false, true} {
+		g := newViewGrove(t)
+		oldest := g.reply(t, nil, "oldest")
+		first := g.reply(t, nil, "first\nof two lines")
+		between := g.reply(t, first, "between")
+		last := g.reply(t, nil, "last")
+		newest := g.reply(t, first, "newest\nof\nthree lines")
+
+		v := g.view(t, first, last)
+		v.LoadingOlder = loadingOlder
+		if err := v.Render(); err != nil {
+			t.Fatalf("failed rendering: %v", err)
+		}
+		v.SetCursor(0, v.LineOf(first.ID())+1)
+		replies := []*forest.Reply{first, last}
+		for _, reply := range []*forest.Reply{oldest, between, newest} {
+			v.ReplyList.AddReplies(reply)
+			if err := v.InsertReply(reply); err != nil {
+				t.Fatalf("failed inserting %q: %v", string(reply.Content.Blob), err)
+			}
+			replies = append(replies, reply)
+			expectFreshRender(t, v, replies)
+			if !v.rendered[v.Cursor.Y].ID.Equals(first.ID()) {
+				t.Errorf("expected the cursor to stay on the selected reply after inserting %q", string(reply.Content.Blob))
+			}
+		}
+	}
+}
+
+func TestCursorMoveRestylesChangedNodes(t *testing.T) {
+	g := newViewGrove(t)
+	root := g.reply(t, nil, "root")
+	child := g.reply(t, root, "child")
+	other := g.reply(t, nil, "other")
+	unrelated := g.reply(t, nil, "unrelated")
+	v := g.view(t, root, child, other, unrelated)
+	v.SetCursor(0, v.LineOf(other.ID()))
+
+	// remember the lines of each node to tell which were re-rendered
+	lines := make(map[string]*RenderedLine)
+	for _, reply := range []*forest.Reply{root, child, other, unrelated} {
+		lines[reply.ID().String()] = &v.cache[reply.ID().String()].lines[0]
+	}
+	generation := v.generation
+	v.MoveCursor(0, v.LineOf(root.ID())-v.Cursor.Y)
+	if !v.SelectedReplyID.Equals(root.ID()) {
+		t.Fatalf("expected the root to be selected")
+	}
+	if v.generation != generation {
+		t.Errorf("expected a cursor move not to lay out the view again")
+	}
+	for _, test := range []struct {
+		reply   *forest.Reply
+		changed bool
+	}{
+		{root, true},
+		{child, true},
+		{other, true},
+		{unrelated, false},
+	} {
+		id := test.reply.ID().String()
+		if changed := &v.cache[id].lines[0] != lines[id]; changed != test.changed {
+			t.Errorf("expected %q re-rendered to be %v", string(test.reply.Content.Blob), test.changed)
+		}
+	}
+	expectFreshRender(t, v, []*forest.Reply{root, child, other, unrelated})
+}
+
+func TestFilterShowsConversation(t *testing.T) {
+	g := newViewGrove(t)
+	before := g.reply(t, nil, "before")
+	root := g.reply(t, nil, "root")
+	child := g.reply(t, root, "child")
+	other := g.reply(t, nil, "other")
+	grandchild := g.reply(t, child, "grandchild")
+	v := g.view(t, before, root, child, other, grandchild)
+	v.FilterOn(child.ID())
+	for _, reply := range []*forest.Reply{before, other} {
+		if line := v.LineOf(reply.ID()); line != -1 {
+			t.Errorf("expected %q to be hidden, found on line %d", string(reply.Content.Blob), line)
+		}
+	}
+	previous := -1
+	for _, reply := range []*forest.Reply{root, child, grandchild} {
+		line := v.LineOf(reply.ID())
+		if line <= previous {
+			t.Errorf("expected %q after line %d, found on line %d", string(reply.Content.Blob), previous, line)
+		}
+		previous = line
+	}
+	if !v.rendered[v.Cursor.Y].ID.Equals(child.ID()) {
+		t.Errorf("expected the cursor on the filtered reply")
+	}
+}
+
+func TestUnreadCount(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wisteria")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	g := newViewGrove(t)
+	read := g.reply(t, nil, "read")
+	time.Sleep(2 * time.Millisecond)
+	other, _ := testutil.MakeIdentityOrSkip(t)
+	markers, err := LoadReadMarkers(filepath.Join(dir, "read.json"), other.ID().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := g.reply(t, read, "first")
+	second := g.reply(t, nil, "second")
+	v := g.view(t, read, first, second)
+	v.Unread = markers
+	if count := v.UnreadCount(); count != 2 {
+		t.Fatalf("expected 2 unread replies, got %d", count)
+	}
+	if err := v.MarkRead(first); err != nil {
+		t.Fatal(err)
+	}
+	third := g.reply(t, nil, "third")
+	v.ReplyList.AddReplies(third)
+	if err := v.InsertReply(third); err != nil {
+		t.Fatal(err)
+	}
+	if count := v.UnreadCount(); count != 2 {
+		t.Errorf("expected 2 unread replies after marking one read and inserting one, got %d", count)
+	}
+	v.RecountUnread()
+	if count := v.UnreadCount(); count != 2 {
+		t.Errorf("expected 2 unread replies after recounting, got %d", count)
+	}
+}
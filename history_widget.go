@@ -8,13 +8,17 @@ import (
 	"os/exec"
 	"strings"
 	"sync"
+	"time"
 
 	forest "git.sr.ht/~whereswaldon/forest-go"
+	"git.sr.ht/~whereswaldon/forest-go/fields"
 	"git.sr.ht/~whereswaldon/forest-go/store"
+	"git.sr.ht/~whereswaldon/wisteria/keymap"
+	"git.sr.ht/~whereswaldon/wisteria/notify"
 	"git.sr.ht/~whereswaldon/wisteria/replylist"
+	"git.sr.ht/~whereswaldon/wisteria/searchindex"
 	"git.sr.ht/~whereswaldon/wisteria/widgets"
 	wistTcell "git.sr.ht/~whereswaldon/wisteria/widgets/tcell"
-	"github.com/0xAX/notificator"
 	wrap "github.com/bbrks/wrap/v2"
 	"github.com/gdamore/tcell"
 	"github.com/gdamore/tcell/views"
@@ -68,16 +72,85 @@ type HistoryWidget struct {
 	*CellView
 	*wistTcell.Application
 	*Config
-	*notificator.Notificator
 	*EditRequestMap
+	Drafts *DraftStore
+	// Keys resolves keypresses into the actions performed by the HistoryWidget
+	Keys *keymap.Keymap
+	// State persists the community that the history is restricted to
+	State *State
+	// unreadCount is the number of unread messages last reported to watchers
+	unreadCount int
+	// prompts holds the handlers for the input requested by outstanding
+	// prompts, keyed by edit request ID
+	prompts map[int]func(input string)
+	// Index finds matches for searches among replies that haven't been loaded
+	// into the history, if it is set
+	Index *searchindex.Index
+	// Dispatcher presents notifications about arriving replies, and keeps
+	// the history of them
+	Dispatcher *notify.Dispatcher
+	// NotifyRules decides which arriving replies trigger notifications
+	NotifyRules *notify.Engine
+	// Picker chooses the community of new conversations, if it is set
+	Picker *CommunityPicker
+	// RelayManager connects to the relays typed at the relay prompt, if it is
+	// set
+	RelayManager *RelayManager
+	// Guide explains how to get started when there is nothing in the history
+	Guide *views.TextArea
+	// guideLines are the lines of the Guide that follow its heading
+	guideLines []string
 }
 
-func NewHistoryWidget(app *wistTcell.Application, archive store.ExtendedStore, config *Config, notifier *notificator.Notificator) (*HistoryWidget, error) {
+func NewHistoryWidget(app *wistTcell.Application, archive store.ExtendedStore, config *Config, notifier notify.Notifier, keys *keymap.Keymap) (*HistoryWidget, error) {
 	replyList := new(replylist.ReplyList)
 	replyList.SubscribeTo(archive)
+	drafts, err := NewDraftStore(config.DraftDirectory())
+	if err != nil {
+		return nil, fmt.Errorf("failed initializing drafts: %w", err)
+	}
+	readMarkers, err := LoadReadMarkers(config.ReadMarkerPath(), config.IdentityID)
+	if err != nil {
+		return nil, fmt.Errorf("failed loading read markers: %w", err)
+	}
+	state, err := LoadState(config.StatePath())
+	if err != nil {
+		return nil, fmt.Errorf("failed loading saved state: %w", err)
+	}
+	username := ""
+	if identity, err := config.IdentityNode(archive); err != nil {
+		log.Printf("Mentions will not trigger notifications: %v", err)
+	} else {
+		username = string(identity.Name.Blob)
+	}
+	rules, err := config.NotificationRules(username)
+	if err != nil {
+		return nil, fmt.Errorf("failed loading notification rules: %w", err)
+	}
+	dispatcher, err := notify.NewDispatcher(config.Notifications, notifier)
+	if err != nil {
+		return nil, fmt.Errorf("failed configuring notifications: %w", err)
+	}
+	// combined notifications are sent later, and must not write to the
+	// terminal while it is being drawn
+	dispatcher.Run = app.PostFunc
+	dispatcher.OnError = func(err error) {
+		log.Printf("Failed sending notification: %v", err)
+	}
 	hv := &HistoryView{
 		ReplyList:     replyList,
 		ExtendedStore: archive,
+		Unread:        readMarkers,
+	}
+	if state.Community != "" {
+		communityID := &fields.QualifiedHash{}
+		if err := communityID.UnmarshalText([]byte(state.Community)); err != nil {
+			log.Printf("Ignoring saved community %s: %v", state.Community, err)
+		} else if _, has, err := archive.GetCommunity(communityID); err != nil || !has {
+			log.Printf("Ignoring saved community %s, which is not in the store", state.Community)
+		} else {
+			hv.CommunityID = communityID
+		}
 	}
 	if err := hv.Render(); err != nil {
 		return nil, fmt.Errorf("failed initializing history view: %w", err)
@@ -92,11 +165,50 @@ func NewHistoryWidget(app *wistTcell.Application, archive store.ExtendedStore, c
 		CellView:       cv,
 		Application:    app,
 		Config:         config,
-		Notificator:    notifier,
+		Dispatcher:     dispatcher,
 		EditRequestMap: NewEditRequestMap(),
+		Drafts:         drafts,
+		Keys:           keys,
+		State:          state,
+		NotifyRules:    rules,
+		prompts:        make(map[int]func(string)),
+		Guide:          views.NewTextArea(),
 	}, nil
 }
 
+// SetGuide sets the lines displayed below the heading of the Guide.
+func (v *HistoryWidget) SetGuide(lines []string) {
+	v.guideLines = lines
+}
+
+// Draw draws the history, or the Guide if there are no messages to show.
+func (v *HistoryWidget) Draw() {
+	if !v.Empty() {
+		v.CellView.Draw()
+		return
+	}
+	community := ""
+	if v.CommunityID != nil {
+		if node, has, err := v.GetCommunity(v.CommunityID); err == nil && has {
+			community = string(node.(*forest.Community).Name.Blob)
+		}
+	}
+	v.Guide.SetLines(append([]string{guideHeading(community), ""}, v.guideLines...))
+	v.Guide.Draw()
+}
+
+// SetView sets the view of both the history and the Guide.
+func (v *HistoryWidget) SetView(view views.View) {
+	v.CellView.SetView(view)
+	v.Guide.SetView(view)
+}
+
+// Resize resizes both the history and the Guide.
+func (v *HistoryWidget) Resize() {
+	v.CellView.Resize()
+	v.Guide.Resize()
+}
+
 var _ views.Widget = &HistoryWidget{}
 
 func (v *HistoryWidget) ReadMessageFile(filename string) {
@@ -117,41 +229,113 @@ func (v *HistoryWidget) ReadMessageFile(filename string) {
 			log.Printf("Failed adding %s: %v", filename, err)
 			return
 		}
-		v.Sort()
-		err = v.Render()
+		reply, isReply := node.(*forest.Reply)
+		if isReply {
+			err = v.InsertReply(reply)
+		} else {
+			// other nodes may allow previously unrenderable replies to render
+			err = v.Render()
+		}
 		if err != nil {
 			log.Printf("Failed rendering %s: %v", filename, err)
 			return
 		}
 		v.Application.Update()
-		if reply, ok := node.(*forest.Reply); ok {
+		if isReply {
+			v.UpdateUnreadCount()
 			v.TryNotify(reply)
 		}
 	})
 }
 
-// TryNotify checks whether a desktop notification should be sent
-// and attempts to send it
+// TryNotify checks whether the reply matches the notification rules and
+// dispatches a notification if so
 func (v *HistoryWidget) TryNotify(reply *forest.Reply) {
-	identity, err := v.Config.IdentityNode(v.ExtendedStore)
-	if err != nil {
-		log.Printf("couldn't look up local identity: %v", err)
-		return
-	}
-	username := strings.ToLower(string(identity.Name.Blob))
-	messageText := strings.ToLower(string(reply.Content.Blob))
-	if !strings.Contains(messageText, username) {
+	match, notable := v.NotifyRules.Match(v.notificationMessage(reply))
+	if !notable {
 		return
 	}
 	author, has, err := v.Get(&reply.Author)
 	if err != nil {
-		log.Printf("Couldn't render desktop notification: %v", err)
+		log.Printf("Couldn't render notification: %v", err)
 		return
 	} else if !has {
-		log.Println("Couldn't render desktop notification: author information missing")
+		log.Println("Couldn't render notification: author information missing")
 		return
 	}
-	log.Printf("Pushing notification: %v", v.Push("Arbor Mention from "+string(author.(*forest.Identity).Name.Blob), string(reply.Content.Blob), "", notificator.UR_NORMAL))
+	log.Printf("Dispatching %s notification for %s", match.Reason, reply.ID())
+	v.Dispatcher.Dispatch(notify.Event{
+		Match:  match,
+		Author: string(author.(*forest.Identity).Name.Blob),
+		Body:   string(reply.Content.Blob),
+		Time:   time.Now(),
+	})
+}
+
+// ToggleDoNotDisturb suppresses notifications, or resumes them if they are
+// already suppressed. Suppressed notifications are kept in the history.
+func (v *HistoryWidget) ToggleDoNotDisturb() {
+	enabled := !v.Dispatcher.DoNotDisturb()
+	v.Dispatcher.SetDoNotDisturb(enabled)
+	if enabled {
+		log.Println("Do not disturb: notifications are suppressed")
+	} else {
+		log.Println("Do not disturb is off")
+	}
+	v.PostEvent(widgets.NewEventDoNotDisturb(v, enabled))
+}
+
+// notificationMessage describes the reply in the terms that notification
+// rules match on.
+func (v *HistoryWidget) notificationMessage(reply *forest.Reply) notify.Message {
+	message := notify.Message{
+		Content:   string(reply.Content.Blob),
+		Community: reply.CommunityID.String(),
+		FromSelf:  reply.Author.String() == v.Config.IdentityID,
+		Followed:  v.State.IsFollowed(conversationRootID(reply).String()),
+	}
+	if community, has, err := v.GetCommunity(&reply.CommunityID); err == nil && has {
+		message.CommunityName = string(community.(*forest.Community).Name.Blob)
+	}
+	if reply.Depth > 1 {
+		if node, has, err := v.Get(&reply.Parent); err == nil && has {
+			if parent, ok := node.(*forest.Reply); ok {
+				message.ReplyToSelf = parent.Author.String() == v.Config.IdentityID
+			}
+		}
+	}
+	return message
+}
+
+// SetFollowing follows or unfollows the conversation containing the reply.
+// Notification rules can match replies in followed conversations.
+func (v *HistoryWidget) SetFollowing(reply *forest.Reply, follow bool) error {
+	rootID := conversationRootID(reply).String()
+	if err := v.State.Update(func(state *State) bool {
+		return state.SetFollowed(rootID, follow)
+	}); err != nil {
+		return fmt.Errorf("failed saving followed conversations: %w", err)
+	}
+	return nil
+}
+
+// ToggleFollowing follows the conversation containing the selected reply, or
+// unfollows it if it is already followed.
+func (v *HistoryWidget) ToggleFollowing() error {
+	reply, err := v.CurrentReply()
+	if err != nil {
+		return fmt.Errorf("couldn't determine current reply: %w", err)
+	}
+	follow := !v.State.IsFollowed(conversationRootID(reply).String())
+	if err := v.SetFollowing(reply, follow); err != nil {
+		return err
+	}
+	if follow {
+		log.Println("Following the selected conversation")
+	} else {
+		log.Println("No longer following the selected conversation")
+	}
+	return nil
 }
 
 // StartReply begins a new reply with the currently-selected message as its
@@ -174,95 +358,167 @@ func (v *HistoryWidget) CurrentReplyConfig() (forest.Node, string, error) {
 	return reply, msg, nil
 }
 
-func (v *HistoryWidget) NewConversationConfig() (forest.Node, string, error) {
-	reply, err := v.CurrentReply()
-	if err != nil {
-		return nil, "", fmt.Errorf("couldn't determine current reply: %w", err)
+// CurrentCommunityID returns the ID of the community of the selected message,
+// or of the community that the history is restricted to if no message is
+// selected. It returns nil if neither is known.
+func (v *HistoryWidget) CurrentCommunityID() *fields.QualifiedHash {
+	if reply, err := v.CurrentReply(); err == nil {
+		return &reply.CommunityID
+	}
+	return v.CommunityID
+}
+
+// NewConversationConfig returns the template for a new conversation in the
+// community.
+func (v *HistoryWidget) NewConversationConfig(community *forest.Community) (forest.Node, string) {
+	msg := fmt.Sprintf("# starting new conversation in %s\n", string(community.Name.Blob))
+	return community, msg
+}
+
+// conversationPrompt is displayed while choosing the community of a new
+// conversation
+const conversationPrompt = "Choose a community for the new conversation"
+
+// PickCommunity asks the user which community a new conversation should begin
+// in, preselecting the current community, and then calls start with it. If
+// there is no Picker, the current community is used without asking.
+func (v *HistoryWidget) PickCommunity(start func(community *forest.Community) error) error {
+	communityID := v.CurrentCommunityID()
+	if v.Picker != nil {
+		v.Picker.Pick(conversationPrompt, communityID, func(community *forest.Community) {
+			if err := start(community); err != nil {
+				log.Printf("Error starting conversation: %v", err)
+			}
+		})
+		return nil
+	}
+	if communityID == nil {
+		return fmt.Errorf("no community is selected")
 	}
-	community, _, err := v.GetCommunity(&reply.CommunityID)
+	community, has, err := v.GetCommunity(communityID)
 	if err != nil {
-		return nil, "", fmt.Errorf("couldn't locate current community: %w", err)
+		return fmt.Errorf("couldn't locate current community: %w", err)
+	} else if !has {
+		return fmt.Errorf("current community %s is not in the store", communityID)
 	}
-	msg := fmt.Sprintf("# starting new conversation in %s\n", string(community.(*forest.Community).Name.Blob))
-	return community, msg, nil
+	return start(community.(*forest.Community))
 }
 
 func (v *HistoryWidget) EmitReplyRequest() error {
-	reply, msg, err := v.CurrentReplyConfig()
+	reply, _, err := v.CurrentReplyConfig()
 	if err != nil {
 		return fmt.Errorf("failed getting current reply configuration: %w", err)
 	}
-	v.EmitEditorRequest(reply, msg)
+	v.EmitEditorRequest(reply)
 	return nil
 }
 
+// EmitConversationRequest asks for an inline editor to start a conversation in
+// the community chosen by the user.
 func (v *HistoryWidget) EmitConversationRequest() error {
-	community, msg, err := v.NewConversationConfig()
-	if err != nil {
-		return fmt.Errorf("failed getting current reply configuration: %w", err)
-	}
-	v.EmitEditorRequest(community, msg)
-	return nil
+	return v.PickCommunity(func(community *forest.Community) error {
+		v.EmitEditorRequest(community)
+		return nil
+	})
 }
 
-func (v *HistoryWidget) EmitEditorRequest(parent forest.Node, startText string) {
-	editReq := widgets.NewEventEditRequest(v.EditRequestMap.Insert(parent), v, startText)
+// EmitEditorRequest asks for an inline editor to reply to the parent, restoring
+// any saved draft reply to that parent.
+func (v *HistoryWidget) EmitEditorRequest(parent forest.Node) {
+	draft, _, err := v.Drafts.Load(parent.ID())
+	if err != nil {
+		log.Printf("Failed restoring draft: %v", err)
+	}
+	editReq := widgets.NewEventEditRequest(v.EditRequestMap.Insert(parent), v, draft)
 	v.PostEvent(editReq)
 }
 
-// StartNewNode launches an Editor to write and send a new arbor node.
+// StartNewNode launches an Editor to write and send a new arbor node. The editor
+// works on the draft reply to the parent, which is populated with startText if
+// there was no draft yet.
 func (v *HistoryWidget) StartNewNode(parent forest.Node, startText string) error {
-	file, err := ioutil.TempFile("", "arbor-msg")
+	_, hasDraft, err := v.Drafts.Load(parent.ID())
 	if err != nil {
-		return fmt.Errorf("couldn't create temporary file for reply: %v", err)
+		return fmt.Errorf("couldn't check for an existing draft: %w", err)
 	}
-	// ensure this file descriptor is closed
-	file.Close()
-	// populate the file, but keep it closed
-	err = ioutil.WriteFile(file.Name(), []byte(startText), 0660)
-	if err != nil {
-		return fmt.Errorf("couldn't write template into temporary file: %v", err)
+	if !hasDraft {
+		if err := v.Drafts.Save(parent.ID(), startText); err != nil {
+			return fmt.Errorf("couldn't write template into draft: %w", err)
+		}
+	}
+	draftPath := v.Drafts.PathFor(parent.ID())
+	editor, inTerminal := v.Config.EditFile(draftPath)
+	if inTerminal {
+		// hand the terminal over to the editor until it exits
+		v.Application.Suspend(func() {
+			editor.Stdin = os.Stdin
+			editor.Stdout = os.Stdout
+			editor.Stderr = os.Stderr
+			if err := editor.Start(); err != nil {
+				log.Printf("Failed to start editor command: %v", err)
+				return
+			}
+			v.FinishReply(parent, draftPath, editor)
+		})
+		return nil
 	}
-	editor := v.Config.EditFile(file.Name())
 	if err := editor.Start(); err != nil {
 		return fmt.Errorf("failed to start editor command: %v", err)
 	}
-	go v.FinishReply(parent, file.Name(), editor)
+	go v.FinishReply(parent, draftPath, editor)
 	return nil
 }
 
-// StartConversation begins a new conversation in the same community as the
-// currently-selected message.
+// StartConversation begins a new conversation in an external editor in the
+// community chosen by the user.
 func (v *HistoryWidget) StartConversation() error {
-	community, msg, err := v.NewConversationConfig()
-	if err != nil {
-		return fmt.Errorf("couldn't get current community config: %w", err)
-	}
-	return v.StartNewNode(community, msg)
+	return v.PickCommunity(func(community *forest.Community) error {
+		return v.StartNewNode(v.NewConversationConfig(community))
+	})
 }
 
 // FinishReply waits for the provided editor command to complete (it is expected
-// to have already started) and writes the contents of the named file as a new
-// node.
-func (v *HistoryWidget) FinishReply(parent forest.Node, replyFileName string, editor *exec.Cmd) {
+// to have already started) and then writes the contents of the named draft file
+// as a new node on the application's goroutine, where the Config may be read
+// safely. The draft is kept if the reply cannot be sent.
+func (v *HistoryWidget) FinishReply(parent forest.Node, draftFileName string, editor *exec.Cmd) {
 	if err := editor.Wait(); err != nil {
 		log.Printf("Error waiting on editor command to finish: %v", err)
-		log.Printf("There may be a partial message in %s", replyFileName)
+		log.Printf("Your draft is saved in %s", draftFileName)
 		return
 	}
-	replyContent, err := ioutil.ReadFile(replyFileName)
+	replyContent, err := ioutil.ReadFile(draftFileName)
 	if err != nil {
-		log.Printf("Error reading reply from %s: %v", replyFileName, err)
+		log.Printf("Error reading reply from %s: %v", draftFileName, err)
 		return
 	}
-	if err := v.FinishReplyString(parent, string(replyContent)); err != nil {
-		log.Printf("Error creating & sending reply: %v", err)
+	v.Application.PostFunc(func() {
+		v.finishOrSaveDraft(parent, string(replyContent))
+	})
+}
+
+// finishOrSaveDraft sends the content as a reply to the parent and discards the
+// draft reply to that parent. If sending fails, the content is saved as the draft
+// instead. Content without any text is discarded.
+func (v *HistoryWidget) finishOrSaveDraft(parent forest.Node, content string) {
+	if strings.TrimSpace(stripCommentLines(content)) == "" {
+		if err := v.Drafts.Delete(parent.ID()); err != nil {
+			log.Printf("Error discarding empty draft: %v", err)
+		}
 		return
 	}
-	if err := os.Remove(replyFileName); err != nil {
-		log.Printf("Error removing %s: %v", replyFileName, err)
+	if err := v.FinishReplyString(parent, content); err != nil {
+		log.Printf("Error creating & sending reply: %v", err)
+		if err := v.Drafts.Save(parent.ID(), content); err != nil {
+			log.Printf("Error saving draft: %v", err)
+			return
+		}
+		log.Printf("Your draft is saved in %s", v.Drafts.PathFor(parent.ID()))
 		return
 	}
+	if err := v.Drafts.Delete(parent.ID()); err != nil {
+		log.Printf("Error removing sent draft: %v", err)
+	}
 }
 
 func (v *HistoryWidget) NewReply(parent interface{}, content string, metadata []byte) (forest.Node, error) {
@@ -291,6 +547,365 @@ func (v *HistoryWidget) FinishReplyString(parent forest.Node, content string) er
 	if err != nil {
 		return fmt.Errorf("failed saving reply into store: %w", err)
 	}
+	// follow the conversations that the user takes part in
+	v.Application.PostFunc(func() {
+		if err := v.SetFollowing(reply.(*forest.Reply), true); err != nil {
+			log.Printf("Failed following conversation: %v", err)
+		}
+	})
+	return nil
+}
+
+// searchPrompt is displayed while the user types a search query
+const searchPrompt = `Search older messages; \c to ignore case, \C to match case, \v for a regular expression; Esc to cancel; empty search clears`
+
+// EmitPromptRequest asks for a line of input to be typed inline below the
+// prompt. The input is passed to handle unless the prompt is cancelled.
+func (v *HistoryWidget) EmitPromptRequest(prompt string, handle func(input string)) {
+	// no parent node is associated with a prompt
+	id := v.EditRequestMap.Insert(nil)
+	v.prompts[id] = handle
+	v.PostEvent(widgets.NewEventPromptRequest(id, v, prompt))
+}
+
+// EmitSearchRequest asks for a search query to be typed inline.
+func (v *HistoryWidget) EmitSearchRequest() {
+	v.EmitPromptRequest(searchPrompt, v.StartSearch)
+}
+
+// StartSearch highlights the messages that match the query and selects the
+// nearest one above the cursor. An empty query clears the current search.
+func (v *HistoryWidget) StartSearch(query string) {
+	query = strings.TrimSpace(strings.ReplaceAll(query, "\n", " "))
+	if query == "" {
+		v.SetSearch(nil)
+		log.Println("Cleared search")
+		return
+	}
+	search, err := NewSearch(query)
+	if err != nil {
+		log.Printf("Failed searching for %q: %v", query, err)
+		return
+	}
+	if err := v.loadIndexedMatches(search); err != nil {
+		log.Printf("Failed loading older matches for %q: %v", query, err)
+	}
+	v.SetSearch(search)
+	log.Printf("%d messages match %q", v.SearchMatches(), query)
+	v.cursorToMatch(true)
+}
+
+// indexedMatchLimit is the largest number of matches that a single search loads
+// from the search index
+const indexedMatchLimit = 256
+
+// loadIndexedMatches adds the replies that the search index finds for the search
+// to the history, so that matches which weren't loaded yet are displayed.
+func (v *HistoryWidget) loadIndexedMatches(search *Search) error {
+	if v.Index == nil || search.Regexp {
+		// the index can't evaluate regular expressions
+		return nil
+	}
+	docs := append(
+		v.Index.Search(searchindex.Query{Text: search.Text, Limit: indexedMatchLimit}),
+		v.Index.Search(searchindex.Query{Author: search.Text, Limit: indexedMatchLimit})...,
+	)
+	replies := make([]*forest.Reply, 0, len(docs))
+	for _, doc := range docs {
+		id := &fields.QualifiedHash{}
+		if err := id.UnmarshalText([]byte(doc.ID)); err != nil {
+			return fmt.Errorf("failed parsing indexed ID %s: %w", doc.ID, err)
+		}
+		if _, loaded := v.Lookup(id); loaded {
+			continue
+		}
+		node, has, err := v.Get(id)
+		if err != nil {
+			return fmt.Errorf("failed loading %s: %w", doc.ID, err)
+		} else if !has {
+			continue
+		}
+		if reply, ok := node.(*forest.Reply); ok {
+			replies = append(replies, reply)
+		}
+	}
+	if v.ReplyList.AddReplies(replies...) == 0 {
+		return nil
+	}
+	return v.renderInPlace()
+}
+
+// cursorToMatch selects the next older (or newer, if older is false) message
+// matching the current search.
+func (v *HistoryWidget) cursorToMatch(older bool) {
+	if v.Search == nil {
+		log.Println("No search in progress")
+		return
+	}
+	found, wrapped := v.SelectMatch(older)
+	if !found {
+		log.Printf("No messages match %q", v.Search.Query)
+		return
+	}
+	if wrapped {
+		log.Println("Search wrapped around")
+	}
+	v.UpdateCursor()
+}
+
+// ScopeToCommunity restricts the history to the community with the given ID, or
+// shows every community if it is nil. The choice is saved for future runs.
+func (v *HistoryWidget) ScopeToCommunity(communityID *fields.QualifiedHash) error {
+	if err := v.ScopeTo(communityID); err != nil {
+		return fmt.Errorf("failed rendering community: %w", err)
+	}
+	v.UpdateCursor()
+	v.AnnounceScope()
+	community := ""
+	if communityID != nil {
+		community = communityID.String()
+	}
+	if err := v.State.Update(func(state *State) bool {
+		state.Community = community
+		return true
+	}); err != nil {
+		return fmt.Errorf("failed saving community choice: %w", err)
+	}
+	return nil
+}
+
+// AnnounceScope notifies watchers of the community that the history is
+// restricted to.
+func (v *HistoryWidget) AnnounceScope() {
+	var community *forest.Community
+	if v.CommunityID != nil {
+		node, has, err := v.GetCommunity(v.CommunityID)
+		if err != nil {
+			log.Printf("Failed looking up community %s: %v", v.CommunityID, err)
+		} else if has {
+			community = node.(*forest.Community)
+		}
+	}
+	v.PostEvent(widgets.NewEventCommunityScope(v, community))
+}
+
+// communityNamePrompt and communityDescriptionPrompt are displayed while the
+// user describes a new community
+const (
+	communityNamePrompt        = "Name the new community; Esc to cancel"
+	communityDescriptionPrompt = "Describe the new community (optional); Enter to create it, Esc to cancel"
+)
+
+// EmitCommunityRequest asks for the name and description of a new community to
+// be typed inline, then creates the community and switches the history to it.
+// If created is not nil, it is then called with the new community.
+func (v *HistoryWidget) EmitCommunityRequest(created func(*forest.Community)) {
+	v.EmitPromptRequest(communityNamePrompt, func(name string) {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			log.Println("Not creating a community without a name")
+			return
+		}
+		v.EmitPromptRequest(communityDescriptionPrompt, func(description string) {
+			community, err := v.StartCommunity(name, description)
+			if err != nil {
+				log.Printf("Failed creating community %q: %v", name, err)
+				return
+			}
+			if created != nil {
+				created(community)
+			}
+		})
+	})
+}
+
+// relayPrompt is displayed while the user types the address of a relay
+const relayPrompt = "Address of a relay to connect to, like arbor.example.com:7117; Esc to cancel"
+
+// EmitRelayRequest asks for the address of a relay to connect to.
+func (v *HistoryWidget) EmitRelayRequest() {
+	v.EmitPromptRequest(relayPrompt, func(address string) {
+		if err := v.ConnectRelay(address); err != nil {
+			log.Printf("Failed connecting to relay: %v", err)
+		}
+	})
+}
+
+// ConnectRelay connects to the relay at the address.
+func (v *HistoryWidget) ConnectRelay(address string) error {
+	if v.RelayManager == nil {
+		return fmt.Errorf("relays cannot be changed while wisteria runs")
+	}
+	address = strings.TrimSpace(address)
+	if address == "" {
+		return fmt.Errorf("no address given")
+	}
+	if err := v.RelayManager.Connect(Relay{Address: address}); err != nil {
+		return err
+	}
+	log.Printf("Connecting to %s", address)
+	return nil
+}
+
+// trustPrompt warns that a relay's certificate changed and asks whether to
+// trust the new one
+const trustPrompt = "WARNING: the certificate of relay %s changed from %s to %s. Someone may be intercepting the connection. Type yes to trust the new certificate; anything else keeps the relay disconnected"
+
+// EmitTrustRequest warns that the relay presented a certificate other than
+// the pinned one, and trusts the new certificate if the user agrees.
+func (v *HistoryWidget) EmitTrustRequest(mismatch *FingerprintMismatchError) {
+	prompt := fmt.Sprintf(trustPrompt, mismatch.Address, mismatch.Pinned, mismatch.Presented)
+	v.EmitPromptRequest(prompt, func(answer string) {
+		if !strings.EqualFold(strings.TrimSpace(answer), "yes") {
+			log.Printf("Not trusting the new certificate of %s", mismatch.Address)
+			return
+		}
+		if err := v.RelayManager.TrustCertificate(mismatch); err != nil {
+			log.Printf("Failed trusting the new certificate of %s: %v", mismatch.Address, err)
+			return
+		}
+		log.Printf("Trusting certificate %s of %s", mismatch.Presented, mismatch.Address)
+	})
+}
+
+// AnnounceRelays summarizes the states of the relays for the watchers.
+func (v *HistoryWidget) AnnounceRelays() {
+	if v.RelayManager == nil {
+		return
+	}
+	connected, reconnecting, failed, total := 0, 0, 0, 0
+	for _, relay := range v.RelayManager.Relays() {
+		switch relay.State {
+		case RelayConnected:
+			connected++
+		case RelayReconnecting:
+			reconnecting++
+		case RelayFailed, RelayUntrusted:
+			failed++
+		}
+		if relay.Active() {
+			total++
+		}
+	}
+	v.PostEvent(widgets.NewEventRelays(v, connected, reconnecting, failed, total))
+}
+
+// StartCommunity creates a community with the given name and description and
+// switches the history to it.
+func (v *HistoryWidget) StartCommunity(name, description string) (*forest.Community, error) {
+	community, err := CreateCommunity(v.Config, v.ExtendedStore, name, description)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Created community %q (%s)", name, community.ID())
+	return community, v.ScopeToCommunity(community.ID())
+}
+
+// SwitchIdentity posts as the identity at the given index of the configured
+// IdentityProfiles from now on, asking for its passphrase if necessary.
+func (v *HistoryWidget) SwitchIdentity(index int) error {
+	previous := v.Config.ActiveIdentity()
+	if index == previous {
+		return nil
+	}
+	if err := v.Config.SwitchIdentity(index); err != nil {
+		return err
+	}
+	if !v.Config.NeedsPassphrase() {
+		return v.finishSwitchingIdentity(previous)
+	}
+	// the passphrase must not be echoed, so ask for it outside of the TUI
+	v.Application.Suspend(func() {
+		wizard := &Wizard{
+			Config:   v.Config,
+			Prompter: NewStdoutPrompter(os.Stdin, int(os.Stdin.Fd()), os.Stdout),
+		}
+		prompt := fmt.Sprintf("Please enter the passphrase of arbor identity %s (hit enter when finished):", v.Config.IdentityID)
+		if err := wizard.ConfigurePassphrase(prompt); err != nil {
+			log.Printf("Failed to get arbor passphrase: %v", err)
+			_ = v.Config.SwitchIdentity(previous)
+			return
+		}
+		if err := v.finishSwitchingIdentity(previous); err != nil {
+			log.Printf("Failed switching identity: %v", err)
+		}
+	})
+	return nil
+}
+
+// finishSwitchingIdentity checks that the identity just switched to can sign
+// nodes, switching back to the identity at the previous index if not. It then
+// loads the read markers and notification rules of the new identity.
+func (v *HistoryWidget) finishSwitchingIdentity(previous int) error {
+	if _, err := v.Config.Builder(v.ExtendedStore); err != nil {
+		// forget a passphrase that may have been mistyped
+		v.Config.passphraseEnclave = nil
+		_ = v.Config.SwitchIdentity(previous)
+		return fmt.Errorf("cannot sign as the chosen identity: %w", err)
+	}
+	if err := v.Unread.Save(); err != nil {
+		log.Printf("Failed saving read markers: %v", err)
+	}
+	readMarkers, err := LoadReadMarkers(v.Config.ReadMarkerPath(), v.Config.IdentityID)
+	if err != nil {
+		return fmt.Errorf("failed loading read markers: %w", err)
+	}
+	v.Unread = readMarkers
+	v.RecountUnread()
+	identity, err := v.Config.IdentityNode(v.ExtendedStore)
+	if err != nil {
+		return fmt.Errorf("failed getting identity node: %w", err)
+	}
+	rules, err := v.Config.NotificationRules(string(identity.Name.Blob))
+	if err != nil {
+		return fmt.Errorf("failed loading notification rules: %w", err)
+	}
+	v.NotifyRules = rules
+	if err := v.Render(); err != nil {
+		return fmt.Errorf("failed rendering history: %w", err)
+	}
+	log.Printf("Now posting as %s", string(identity.Name.Blob))
+	v.UpdateCursor()
+	v.UpdateUnreadCount()
+	v.AnnounceIdentity()
+	return nil
+}
+
+// AnnounceIdentity notifies watchers of the identity in use.
+func (v *HistoryWidget) AnnounceIdentity() {
+	identity, err := v.Config.IdentityNode(v.ExtendedStore)
+	if err != nil {
+		log.Printf("Failed looking up identity: %v", err)
+		return
+	}
+	v.PostEvent(widgets.NewEventIdentity(v, identity))
+}
+
+// ShowConversation filters the history to the conversation beginning with the
+// given root, loading any of its replies that are older than the loaded history.
+func (v *HistoryWidget) ShowConversation(root *forest.Reply) error {
+	descendants, err := v.DescendantsOf(root.ID())
+	if err != nil {
+		return fmt.Errorf("failed looking up replies to %s: %w", root.ID(), err)
+	}
+	replies := []*forest.Reply{root}
+	for _, id := range descendants {
+		if _, loaded := v.Lookup(id); loaded {
+			continue
+		}
+		node, has, err := v.Get(id)
+		if err != nil {
+			return fmt.Errorf("failed loading %s: %w", id, err)
+		} else if !has {
+			continue
+		}
+		if reply, ok := node.(*forest.Reply); ok {
+			replies = append(replies, reply)
+		}
+	}
+	v.ReplyList.AddReplies(replies...)
+	v.FilterOn(root.ID())
+	v.UpdateCursor()
 	return nil
 }
 
@@ -299,6 +914,7 @@ func (v *HistoryWidget) FinishReplyString(parent forest.Node, content string) er
 // related to moving the cursor.
 func (v *HistoryWidget) UpdateCursor() {
 	v.MakeCursorVisible()
+	v.LoadOlderIfNeeded()
 	current, err := v.CurrentReply()
 	if err != nil {
 		log.Printf("Failed updating cursor state: %v", err)
@@ -306,6 +922,10 @@ func (v *HistoryWidget) UpdateCursor() {
 	} else if current == nil {
 		return
 	}
+	if err := v.MarkRead(current); err != nil {
+		log.Printf("Failed marking %s read: %v", current.ID(), err)
+	}
+	v.UpdateUnreadCount()
 	author, _, err := v.GetIdentity(&current.Author)
 	if err != nil {
 		log.Printf("Failed updating cursor state, couldn't get author: %v", err)
@@ -317,6 +937,81 @@ func (v *HistoryWidget) UpdateCursor() {
 	v.PostEvent(widgets.NewEventReplySelected(v, current, author.(*forest.Identity), community.(*forest.Community)))
 }
 
+const (
+	// olderHistoryThreshold is how close (in lines) the cursor must come to the
+	// top of the history before older messages are loaded
+	olderHistoryThreshold = 10
+	// olderHistoryPageSize is how many older replies are requested at a time
+	olderHistoryPageSize = 512
+)
+
+// LoadOlderIfNeeded starts loading older history in the background when the cursor
+// nears the top of the view. The cursor stays on the same message once the older
+// history is displayed.
+func (v *HistoryWidget) LoadOlderIfNeeded() {
+	if v.LoadingOlder || v.Cursor.Y > olderHistoryThreshold || v.ReplyList.Exhausted() {
+		return
+	}
+	v.LoadingOlder = true
+	if err := v.renderInPlace(); err != nil {
+		log.Printf("Failed rendering older history marker: %v", err)
+	}
+	go func() {
+		added, err := v.ReplyList.LoadOlder(v.ExtendedStore, olderHistoryPageSize)
+		v.Application.PostFunc(func() {
+			v.LoadingOlder = false
+			if err != nil {
+				log.Printf("Failed loading older history: %v", err)
+			} else {
+				log.Printf("Loaded %d older messages", added)
+			}
+			if added > 0 {
+				v.RecountUnread()
+			}
+			if err := v.renderInPlace(); err != nil {
+				log.Printf("Failed rendering older history: %v", err)
+			}
+			v.UpdateUnreadCount()
+			v.Application.Update()
+		})
+	}()
+}
+
+// renderInPlace re-renders the history while keeping the cursor and the visible
+// region on the same message, even if lines were added above it.
+func (v *HistoryWidget) renderInPlace() error {
+	before := v.LineOf(v.CurrentID())
+	if err := v.Render(); err != nil {
+		return err
+	}
+	after := v.LineOf(v.CurrentID())
+	if before >= 0 && after >= 0 && after != before {
+		v.Cursor.Y += after - before
+		v.CellView.PanDown(after - before)
+	}
+	return nil
+}
+
+// UpdateUnreadCount notifies watchers of the number of unread messages if it
+// has changed.
+func (v *HistoryWidget) UpdateUnreadCount() {
+	count := v.UnreadCount()
+	if count == v.unreadCount {
+		return
+	}
+	v.unreadCount = count
+	v.PostEvent(widgets.NewEventUnreadCount(v, count))
+}
+
+// cursorToUnread selects the next (or previous, if forward is false) unread message.
+func (v *HistoryWidget) cursorToUnread(forward bool) {
+	if !v.SelectUnread(forward) {
+		log.Println("No more unread messages in that direction")
+		return
+	}
+	v.UpdateCursor()
+}
+
 func (v *HistoryWidget) cursorToTop() {
 	v.HistoryView.SetCursor(0, 0)
 	v.UpdateCursor()
@@ -371,8 +1066,26 @@ func (v *HistoryWidget) HandleEvent(event tcell.Event) bool {
 	switch keyEvent := event.(type) {
 	case widgets.EventEditFinished:
 		log.Printf("Got event edit finished: %v", keyEvent)
-		if err := v.FinishReplyString(v.EditRequestMap.Delete(keyEvent.ID), keyEvent.Content); err != nil {
-			log.Printf("Failed finalizing reply: %v", err)
+		if handle, ok := v.prompts[keyEvent.ID]; ok {
+			v.EditRequestMap.Delete(keyEvent.ID)
+			delete(v.prompts, keyEvent.ID)
+			if !keyEvent.Draft {
+				handle(keyEvent.Content)
+			}
+			return true
+		}
+		parent := v.EditRequestMap.Delete(keyEvent.ID)
+		if parent == nil {
+			log.Printf("Failed finalizing reply: no outstanding edit request %d", keyEvent.ID)
+			return true
+		}
+		switch {
+		case !keyEvent.Draft:
+			v.finishOrSaveDraft(parent, keyEvent.Content)
+		case strings.TrimSpace(keyEvent.Content) != "":
+			if err := v.Drafts.Save(parent.ID(), keyEvent.Content); err != nil {
+				log.Printf("Failed saving draft: %v", err)
+			}
 		}
 	case *tcell.EventMouse:
 		buttons := keyEvent.Buttons()
@@ -400,92 +1113,90 @@ func (v *HistoryWidget) HandleEvent(event tcell.Event) bool {
 			v.panRight(mouseScrollMultiplier)
 		}
 	case *tcell.EventKey:
-		switch keyEvent.Key() {
-		case tcell.KeyEnter:
-			if err := v.EmitReplyRequest(); err != nil {
-				log.Printf("Error starting reply: %v", err)
-				return true
-			}
-		case tcell.KeyUp, tcell.KeyCtrlP:
-			v.cursorUpOneLine()
-			return true
-		case tcell.KeyDown, tcell.KeyCtrlN:
-			v.cursorDownOneLine()
-			return true
-		case tcell.KeyRight, tcell.KeyCtrlF:
-			v.cursorRightOneCell()
-			return true
-		case tcell.KeyLeft, tcell.KeyCtrlB:
-			v.cursorLeftOneCell()
-			return true
-		case tcell.KeyPgDn:
-			v.keyPgDn()
-			v.UpdateCursor()
-			return true
-		case tcell.KeyPgUp:
-			v.keyPgUp()
-			v.UpdateCursor()
-			return true
-		case tcell.KeyEnd:
-			v.cursorToBottom()
-			return true
-		case tcell.KeyHome:
-			v.cursorToTop()
-			return true
-		case tcell.KeyRune:
-			// break if it's a normal keypress
-		default:
-			return false
-		}
-		switch keyEvent.Rune() {
-		case 'g':
-			v.cursorToTop()
-			return true
-		case 'G':
-			v.cursorToBottom()
-			return true
-		case 'h':
-			v.cursorLeftOneCell()
-			return true
-		case 'j':
-			v.cursorDownOneLine()
-			return true
-		case 'k':
-			v.cursorUpOneLine()
-			return true
-		case 'l':
-			v.cursorRightOneCell()
-			return true
-		case 'c':
-			if err := v.EmitConversationRequest(); err != nil {
-				log.Printf("Error starting conversation: %v", err)
-				return true
-			}
-		case 'C':
-			if err := v.StartConversation(); err != nil {
-				log.Printf("Error starting conversation: %v", err)
-				return true
-			}
-		case 'i':
-			if err := v.EmitReplyRequest(); err != nil {
-				log.Printf("Error starting conversation: %v", err)
-				return true
-			}
-		case 'I':
-			if err := v.StartReply(); err != nil {
-				log.Printf("Error starting conversation: %v", err)
-				return true
-			}
-		case ' ':
-			v.ToggleFilter()
-			if err := v.Render(); err != nil {
-				log.Printf("Error re-rendering after filter: %v", err)
-			}
-			v.Draw()
-			x, y, _, _ := v.GetCursor()
-			v.port.Center(x, y)
+		action, result := v.Keys.Match(keyEvent)
+		switch result {
+		case keymap.Pending:
 			return true
+		case keymap.Matched:
+			return v.Perform(action)
 		}
 	}
 	return false
 }
+
+// Perform carries out the named action, returning whether the action is one
+// that the HistoryWidget performs.
+func (v *HistoryWidget) Perform(action string) bool {
+	switch action {
+	case ActionCursorUp:
+		v.cursorUpOneLine()
+	case ActionCursorDown:
+		v.cursorDownOneLine()
+	case ActionCursorLeft:
+		v.cursorLeftOneCell()
+	case ActionCursorRight:
+		v.cursorRightOneCell()
+	case ActionPageUp:
+		v.keyPgUp()
+		v.UpdateCursor()
+	case ActionPageDown:
+		v.keyPgDn()
+		v.UpdateCursor()
+	case ActionCursorTop:
+		v.cursorToTop()
+	case ActionCursorBottom:
+		v.cursorToBottom()
+	case ActionNextUnread:
+		v.cursorToUnread(true)
+	case ActionPreviousUnread:
+		v.cursorToUnread(false)
+	case ActionReply:
+		if err := v.EmitReplyRequest(); err != nil {
+			log.Printf("Error starting reply: %v", err)
+		}
+	case ActionReplyExternal:
+		if err := v.StartReply(); err != nil {
+			log.Printf("Error starting reply: %v", err)
+		}
+	case ActionNewConversation:
+		if err := v.EmitConversationRequest(); err != nil {
+			log.Printf("Error starting conversation: %v", err)
+		}
+	case ActionNewConversationExternal:
+		if err := v.StartConversation(); err != nil {
+			log.Printf("Error starting conversation: %v", err)
+		}
+	case ActionNewCommunity:
+		v.EmitCommunityRequest(nil)
+	case ActionConnectRelay:
+		v.EmitRelayRequest()
+	case ActionSearch:
+		v.EmitSearchRequest()
+	case ActionSearchOlder:
+		v.cursorToMatch(true)
+	case ActionSearchNewer:
+		v.cursorToMatch(false)
+	case ActionToggleFollow:
+		if err := v.ToggleFollowing(); err != nil {
+			log.Printf("Error following conversation: %v", err)
+		}
+	case ActionToggleDoNotDisturb:
+		v.ToggleDoNotDisturb()
+	case ActionToggleThreaded:
+		v.ToggleThreaded()
+		v.Draw()
+		x, y, _, _ := v.GetCursor()
+		v.port.Center(x, y)
+	case ActionToggleFilter:
+		v.ToggleFilter()
+		if err := v.Render(); err != nil {
+			log.Printf("Error re-rendering after filter: %v", err)
+		}
+		v.Draw()
+		x, y, _, _ := v.GetCursor()
+		v.port.Center(x, y)
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	forest "git.sr.ht/~whereswaldon/forest-go"
+	"git.sr.ht/~whereswaldon/forest-go/fields"
+	"git.sr.ht/~whereswaldon/wisteria/widgets"
+	"github.com/gdamore/tcell"
+)
+
+// IdentitiesWidget lists the configured identities, marking the one in use,
+// and switches to the selected one on Enter.
+type IdentitiesWidget struct {
+	*widgets.List
+	History *HistoryWidget
+}
+
+// NewIdentitiesWidget creates a widget listing the identities configured for
+// the history widget.
+func NewIdentitiesWidget(history *HistoryWidget) *IdentitiesWidget {
+	i := &IdentitiesWidget{
+		List:    widgets.NewList(),
+		History: history,
+	}
+	i.Refresh()
+	return i
+}
+
+// describeIdentity renders the name and ID of an identity on one line.
+func (i *IdentitiesWidget) describeIdentity(identityID string) string {
+	id := &fields.QualifiedHash{}
+	if err := id.UnmarshalText([]byte(identityID)); err != nil {
+		return identityID
+	}
+	node, has, err := i.History.GetIdentity(id)
+	if err != nil || !has {
+		return identityID
+	}
+	return fmt.Sprintf("%s  %s", string(node.(*forest.Identity).Name.Blob), identityID)
+}
+
+// Refresh rebuilds the listing from the configuration.
+func (i *IdentitiesWidget) Refresh() {
+	config := i.History.Config
+	profiles := config.IdentityProfiles()
+	items := make([]string, 0, len(profiles)+2)
+	items = append(items, "Identities (Enter to switch)")
+	for index, profile := range profiles {
+		action := "Switch to "
+		if index == config.ActiveIdentity() {
+			action = "Posting as "
+		}
+		items = append(items, action+i.describeIdentity(profile.IdentityID))
+	}
+	if len(config.Identities) == 0 {
+		items = append(items, "List more identities under Identities in your configuration file to switch between them")
+	}
+	i.SetItems(items)
+}
+
+// Draw refreshes the listing and then draws it.
+func (i *IdentitiesWidget) Draw() {
+	i.Refresh()
+	i.List.Draw()
+}
+
+// HandleEvent switches to the selected identity on Enter, and dismisses the
+// listing on Enter or Esc.
+func (i *IdentitiesWidget) HandleEvent(ev tcell.Event) bool {
+	if event, ok := ev.(*tcell.EventKey); ok {
+		switch event.Key() {
+		case tcell.KeyEnter:
+			if index := i.Selected() - 1; index >= 0 && index < len(i.History.Config.IdentityProfiles()) {
+				if err := i.History.SwitchIdentity(index); err != nil {
+					log.Printf("Failed switching identity: %v", err)
+				}
+			}
+			i.PostEvent(widgets.NewEventShowContent(i))
+			return true
+		case tcell.KeyEscape:
+			i.PostEvent(widgets.NewEventShowContent(i))
+			return true
+		}
+	}
+	return i.List.HandleEvent(ev)
+}
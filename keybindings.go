@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"git.sr.ht/~whereswaldon/wisteria/keymap"
+	"git.sr.ht/~whereswaldon/wisteria/widgets"
+)
+
+// Names of the actions performed by the history widget
+const (
+	ActionCursorUp                = "cursor-up"
+	ActionCursorDown              = "cursor-down"
+	ActionCursorLeft              = "cursor-left"
+	ActionCursorRight             = "cursor-right"
+	ActionPageUp                  = "page-up"
+	ActionPageDown                = "page-down"
+	ActionCursorTop               = "cursor-top"
+	ActionCursorBottom            = "cursor-bottom"
+	ActionNextUnread              = "next-unread"
+	ActionPreviousUnread          = "previous-unread"
+	ActionReply                   = "reply"
+	ActionReplyExternal           = "reply-external"
+	ActionNewConversation         = "new-conversation"
+	ActionNewConversationExternal = "new-conversation-external"
+	ActionNewCommunity            = "new-community"
+	ActionConnectRelay            = "connect-relay"
+	ActionSearch                  = "search"
+	ActionSearchOlder             = "search-older"
+	ActionSearchNewer             = "search-newer"
+	ActionToggleFilter            = "toggle-filter"
+	ActionToggleThreaded          = "toggle-threaded"
+	ActionToggleFollow            = "toggle-follow"
+	ActionToggleDoNotDisturb      = "toggle-dnd"
+	ActionToggleNotifications     = "toggle-notifications"
+	ActionToggleIdentities        = "toggle-identities"
+	ActionToggleDrafts            = "toggle-drafts"
+	ActionToggleHelp              = "toggle-help"
+	ActionToggleCommunities       = "toggle-communities"
+	ActionToggleRelays            = "toggle-relays"
+)
+
+// HistoryActions are the actions performed by the history widget along with
+// their default key bindings.
+var HistoryActions = []keymap.Action{
+	{Name: ActionCursorUp, Description: "select the previous line", Keys: []string{"Up", "Ctrl-P", "k"}},
+	{Name: ActionCursorDown, Description: "select the next line", Keys: []string{"Down", "Ctrl-N", "j"}},
+	{Name: ActionCursorLeft, Description: "move the cursor left", Keys: []string{"Left", "Ctrl-B", "h"}},
+	{Name: ActionCursorRight, Description: "move the cursor right", Keys: []string{"Right", "Ctrl-F", "l"}},
+	{Name: ActionPageUp, Description: "scroll up one page", Keys: []string{"PgUp"}},
+	{Name: ActionPageDown, Description: "scroll down one page", Keys: []string{"PgDn"}},
+	{Name: ActionCursorTop, Description: "select the oldest message", Keys: []string{"Home", "g"}},
+	{Name: ActionCursorBottom, Description: "select the newest message", Keys: []string{"End", "G"}},
+	{Name: ActionNextUnread, Description: "select the next unread message", Keys: []string{"u"}},
+	{Name: ActionPreviousUnread, Description: "select the previous unread message", Keys: []string{"U"}},
+	{Name: ActionReply, Description: "reply to the selected message", Keys: []string{"Enter", "i"}},
+	{Name: ActionReplyExternal, Description: "reply to the selected message in an external editor", Keys: []string{"I"}},
+	{Name: ActionNewConversation, Description: "start a new conversation in the selected community", Keys: []string{"c"}},
+	{Name: ActionNewConversationExternal, Description: "start a new conversation in an external editor", Keys: []string{"C"}},
+	{Name: ActionNewCommunity, Description: "create a new community and switch to it", Keys: []string{"A"}},
+	{Name: ActionConnectRelay, Description: "connect to another relay", Keys: []string{"R"}},
+	{Name: ActionSearch, Description: "search message content and author names", Keys: []string{"/"}},
+	{Name: ActionSearchOlder, Description: "select the next older search match", Keys: []string{"n"}},
+	{Name: ActionSearchNewer, Description: "select the next newer search match", Keys: []string{"N"}},
+	{Name: ActionToggleFilter, Description: "show only the selected conversation", Keys: []string{"Space"}},
+	{Name: ActionToggleThreaded, Description: "switch between chronological and threaded layout", Keys: []string{"t"}},
+	{Name: ActionToggleFollow, Description: "follow or unfollow the selected conversation", Keys: []string{"f"}},
+	{Name: ActionToggleDoNotDisturb, Description: "suppress notifications, or resume them", Keys: []string{"z"}},
+}
+
+// GlobalActions are the actions performed by the top-level switcher along with
+// their default key bindings.
+var GlobalActions = []keymap.Action{
+	{Name: widgets.ActionQuit, Description: "quit wisteria", Keys: []string{"Ctrl-C"}},
+	{Name: widgets.ActionToggleLog, Description: "show or hide the log", Keys: []string{"L"}},
+	{Name: ActionToggleDrafts, Description: "show or hide saved drafts", Keys: []string{"D"}},
+	{Name: ActionToggleCommunities, Description: "show or hide the list of communities", Keys: []string{"b"}},
+	{Name: ActionToggleNotifications, Description: "show or hide the history of notifications", Keys: []string{"H"}},
+	{Name: ActionToggleIdentities, Description: "show or hide the identity switcher", Keys: []string{"p"}},
+	{Name: ActionToggleRelays, Description: "show or hide the status of the relays, to connect or disconnect them", Keys: []string{"r"}},
+	{Name: ActionToggleHelp, Description: "show or hide this list of key bindings", Keys: []string{"?"}},
+}
+
+// SidebarActions are the actions performed by the sidebar beside the history
+// along with their default key bindings.
+var SidebarActions = []keymap.Action{
+	{Name: widgets.ActionToggleSidebar, Description: "show or hide the list of conversations", Keys: []string{"s"}},
+	{Name: widgets.ActionSwitchFocus, Description: "move focus between the history and the list of conversations", Keys: []string{"Tab"}},
+}
+
+// AllActions holds every action that can be configured in the keymap
+var AllActions = concatActions(HistoryActions, SidebarActions, GlobalActions)
+
+// concatActions joins lists of actions into one.
+func concatActions(lists ...[]keymap.Action) []keymap.Action {
+	all := []keymap.Action{}
+	for _, list := range lists {
+		all = append(all, list...)
+	}
+	return all
+}
+
+// helpHint tells the user how to see the key bindings.
+func helpHint(keys *keymap.Keymap) string {
+	bound := keys.Keys(ActionToggleHelp)
+	if len(bound) == 0 {
+		return "set a key for " + ActionToggleHelp + " to list key bindings"
+	}
+	return bound[0].String() + " for help"
+}
+
+// gettingStartedActions are the actions that the getting started guide suggests
+var gettingStartedActions = []string{
+	ActionConnectRelay,
+	ActionToggleCommunities,
+	ActionNewCommunity,
+	ActionNewConversation,
+	ActionToggleHelp,
+}
+
+// gettingStarted explains how to fetch messages and begin posting to a user
+// whose grove is empty.
+func gettingStarted(keys *keymap.Keymap, grovePath string) []string {
+	lines := []string{
+		"Wisteria shows the arbor messages stored in your grove at",
+		"    " + grovePath,
+		"",
+		"To fetch messages from other people, connect to a sprout relay with",
+		"the key below, by starting wisteria with its address, like so:",
+		"    wisteria arbor.example.com:7117",
+		"or by listing it under Relays in your configuration file.",
+		"",
+		"Messages that arrive will appear here. To get started:",
+	}
+	descriptions := make(map[string]string)
+	for _, action := range keys.Actions() {
+		descriptions[action.Name] = action.Description
+	}
+	for _, name := range gettingStartedActions {
+		bound := keys.Keys(name)
+		if len(bound) == 0 {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("    %-6s %s", bound[0].String(), descriptions[name]))
+	}
+	lines = append(lines, "", "Run `wisteria -h` for more ways to use wisteria.")
+	return lines
+}
+
+// guideHeading summarizes why the history is empty.
+func guideHeading(community string) string {
+	if community == "" {
+		return "There are no messages in your grove yet."
+	}
+	return fmt.Sprintf("There are no messages in %s yet.", strings.TrimSpace(community))
+}
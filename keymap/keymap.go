@@ -0,0 +1,303 @@
+// Package keymap resolves keypresses into named actions according to
+// user-configurable key bindings.
+package keymap
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell"
+)
+
+// Key is a single keypress. Control keys are identified by their tcell.Key
+// alone, so only the Alt modifier is significant.
+type Key struct {
+	Key  tcell.Key
+	Rune rune
+	Alt  bool
+}
+
+// keyAliases are names accepted for keys that tcell reports under another name
+var keyAliases = map[string]tcell.Key{
+	"Ctrl-H": tcell.KeyBackspace,
+	"Ctrl-I": tcell.KeyTab,
+	"Ctrl-M": tcell.KeyEnter,
+	"Ctrl-[": tcell.KeyEsc,
+	"Escape": tcell.KeyEsc,
+	"Return": tcell.KeyEnter,
+}
+
+// KeyOf returns the Key pressed in a key event.
+func KeyOf(ev *tcell.EventKey) Key {
+	k := Key{
+		Key: ev.Key(),
+		Alt: ev.Modifiers()&tcell.ModAlt != 0,
+	}
+	if k.Key == tcell.KeyRune {
+		k.Rune = ev.Rune()
+	}
+	return k
+}
+
+// ParseKey parses a key written like "g", "Space", "Enter", "PgDn", "Ctrl-C"
+// or "Alt-f". Key names are not case-sensitive, but single characters are.
+func ParseKey(spec string) (Key, error) {
+	k := Key{}
+	for _, prefix := range []string{"Alt-", "M-"} {
+		if len(spec) > len(prefix) && strings.EqualFold(spec[:len(prefix)], prefix) {
+			k.Alt = true
+			spec = spec[len(prefix):]
+			break
+		}
+	}
+	if utf8.RuneCountInString(spec) == 1 {
+		k.Key = tcell.KeyRune
+		k.Rune, _ = utf8.DecodeRuneInString(spec)
+		return k, nil
+	}
+	if strings.EqualFold(spec, "Space") {
+		k.Key = tcell.KeyRune
+		k.Rune = ' '
+		return k, nil
+	}
+	for name, key := range keyAliases {
+		if strings.EqualFold(spec, name) {
+			k.Key = key
+			return k, nil
+		}
+	}
+	for key, name := range tcell.KeyNames {
+		if strings.EqualFold(spec, name) {
+			k.Key = key
+			return k, nil
+		}
+	}
+	return Key{}, fmt.Errorf("unknown key %q", spec)
+}
+
+// String returns the key written in the form accepted by ParseKey.
+func (k Key) String() string {
+	name := ""
+	switch {
+	case k.Key == tcell.KeyRune && k.Rune == ' ':
+		name = "Space"
+	case k.Key == tcell.KeyRune:
+		name = string(k.Rune)
+	default:
+		var ok bool
+		if name, ok = tcell.KeyNames[k.Key]; !ok {
+			name = fmt.Sprintf("Key[%d]", k.Key)
+		}
+	}
+	if k.Alt {
+		return "Alt-" + name
+	}
+	return name
+}
+
+// Sequence is one or more keys that must be pressed in order, such as the
+// chord "Ctrl-X Ctrl-C".
+type Sequence []Key
+
+// ParseSequence parses space-separated keys into a Sequence.
+func ParseSequence(spec string) (Sequence, error) {
+	parts := strings.Fields(spec)
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("empty key binding")
+	}
+	seq := make(Sequence, 0, len(parts))
+	for _, part := range parts {
+		k, err := ParseKey(part)
+		if err != nil {
+			return nil, err
+		}
+		seq = append(seq, k)
+	}
+	return seq, nil
+}
+
+// String returns the sequence written in the form accepted by ParseSequence.
+func (s Sequence) String() string {
+	parts := make([]string, len(s))
+	for i, k := range s {
+		parts[i] = k.String()
+	}
+	return strings.Join(parts, " ")
+}
+
+// Action is an operation that keys can be bound to.
+type Action struct {
+	// Name identifies the action in the configuration file
+	Name string
+	// Description explains what the action does
+	Description string
+	// Keys are the default bindings of the action, in the form accepted by
+	// ParseSequence
+	Keys []string
+}
+
+// Result describes how a keypress relates to the bindings of a Keymap.
+type Result int
+
+const (
+	// NoMatch means that the keypress is not bound to anything
+	NoMatch Result = iota
+	// Pending means that the keypress began or continued a chord
+	Pending
+	// Matched means that the keypress completed a binding
+	Matched
+)
+
+// Keymap resolves keypresses into the names of the actions bound to them. It
+// tracks partially-typed chords between calls to Match.
+type Keymap struct {
+	actions []Action
+	// bindings maps the string form of each bound sequence to an action name
+	bindings map[string]string
+	// keys holds the sequences bound to each action name
+	keys map[string][]Sequence
+	// prefixes holds the string form of every proper prefix of a bound sequence
+	prefixes map[string]struct{}
+	pending  Sequence
+}
+
+// New creates a Keymap for the given actions. Each entry in overrides maps an
+// action name to key bindings that replace the default bindings of that action.
+// It errors if the overrides name unknown actions or keys, or if any bindings
+// conflict.
+func New(actions []Action, overrides map[string][]string) (*Keymap, error) {
+	k := &Keymap{
+		actions:  actions,
+		bindings: make(map[string]string),
+		keys:     make(map[string][]Sequence),
+		prefixes: make(map[string]struct{}),
+	}
+	problems := []string{}
+	known := make(map[string]struct{}, len(actions))
+	for _, action := range actions {
+		known[action.Name] = struct{}{}
+	}
+	overridden := make([]string, 0, len(overrides))
+	for name := range overrides {
+		overridden = append(overridden, name)
+	}
+	sort.Strings(overridden)
+	for _, name := range overridden {
+		if _, ok := known[name]; !ok {
+			problems = append(problems, fmt.Sprintf("unknown action %q", name))
+		}
+	}
+	for _, action := range actions {
+		specs := action.Keys
+		if override, ok := overrides[action.Name]; ok {
+			specs = override
+		}
+		for _, spec := range specs {
+			seq, err := ParseSequence(spec)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("action %q: %v", action.Name, err))
+				continue
+			}
+			if problem := k.bind(action.Name, seq); problem != "" {
+				problems = append(problems, problem)
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return k, nil
+}
+
+// bind binds the sequence to the named action, returning a description of
+// the problem if it conflicts with an existing binding.
+func (k *Keymap) bind(action string, seq Sequence) string {
+	key := seq.String()
+	if existing, ok := k.bindings[key]; ok {
+		if existing == action {
+			return ""
+		}
+		return fmt.Sprintf("%q is bound to both %q and %q", key, existing, action)
+	}
+	if _, ok := k.prefixes[key]; ok {
+		return fmt.Sprintf("%q (%s) is the start of a longer binding", key, action)
+	}
+	for i := 1; i < len(seq); i++ {
+		prefix := seq[:i].String()
+		if existing, ok := k.bindings[prefix]; ok {
+			return fmt.Sprintf("%q (%s) starts with %q, which is bound to %q", key, action, prefix, existing)
+		}
+	}
+	for i := 1; i < len(seq); i++ {
+		k.prefixes[seq[:i].String()] = struct{}{}
+	}
+	k.bindings[key] = action
+	k.keys[action] = append(k.keys[action], seq)
+	return ""
+}
+
+// Check reports whether the overrides are valid for the given actions. See New.
+func Check(actions []Action, overrides map[string][]string) error {
+	_, err := New(actions, overrides)
+	return err
+}
+
+// Match consumes a keypress and returns the action that it completes, if any.
+func (k *Keymap) Match(ev *tcell.EventKey) (string, Result) {
+	pressed := KeyOf(ev)
+	chording := len(k.pending) > 0
+	seq := append(k.pending, pressed)
+	if action, result := k.lookup(seq); result != NoMatch {
+		return action, result
+	}
+	if chording {
+		// abandon the chord and try the keypress on its own
+		return k.lookup(Sequence{pressed})
+	}
+	return "", NoMatch
+}
+
+// lookup resolves a complete or partial sequence, updating the pending chord.
+func (k *Keymap) lookup(seq Sequence) (string, Result) {
+	key := seq.String()
+	if action, ok := k.bindings[key]; ok {
+		k.pending = nil
+		return action, Matched
+	}
+	if _, ok := k.prefixes[key]; ok {
+		k.pending = seq
+		return "", Pending
+	}
+	k.pending = nil
+	return "", NoMatch
+}
+
+// Subset returns a Keymap that resolves only the bindings of the given actions.
+// The Subset tracks chords independently of the Keymap that it came from, so
+// different widgets can each match the actions that they handle.
+func (k *Keymap) Subset(actions []Action) *Keymap {
+	subset := &Keymap{
+		actions:  actions,
+		bindings: make(map[string]string),
+		keys:     make(map[string][]Sequence),
+		prefixes: make(map[string]struct{}),
+	}
+	for _, action := range actions {
+		for _, seq := range k.keys[action.Name] {
+			subset.bind(action.Name, seq)
+		}
+	}
+	return subset
+}
+
+// Actions returns the actions known to the Keymap in the order they were provided.
+func (k *Keymap) Actions() []Action {
+	return k.actions
+}
+
+// Keys returns the sequences bound to the named action.
+func (k *Keymap) Keys(action string) []Sequence {
+	return k.keys[action]
+}
@@ -0,0 +1,175 @@
+package keymap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell"
+)
+
+func TestParseKey(t *testing.T) {
+	for _, test := range []struct {
+		spec    string
+		key     Key
+		printed string
+	}{
+		{"g", Key{Key: tcell.KeyRune, Rune: 'g'}, "g"},
+		{"G", Key{Key: tcell.KeyRune, Rune: 'G'}, "G"},
+		{"space", Key{Key: tcell.KeyRune, Rune: ' '}, "Space"},
+		{"Alt-f", Key{Key: tcell.KeyRune, Rune: 'f', Alt: true}, "Alt-f"},
+		{"m-F", Key{Key: tcell.KeyRune, Rune: 'F', Alt: true}, "Alt-F"},
+		{"Ctrl-C", Key{Key: tcell.KeyCtrlC}, "Ctrl-C"},
+		{"ctrl-x", Key{Key: tcell.KeyCtrlX}, "Ctrl-X"},
+		{"Ctrl-H", Key{Key: tcell.KeyBackspace}, "Backspace"},
+		{"Escape", Key{Key: tcell.KeyEsc}, "Esc"},
+		{"Alt-Enter", Key{Key: tcell.KeyEnter, Alt: true}, "Alt-Enter"},
+		{"PgDn", Key{Key: tcell.KeyPgDn}, "PgDn"},
+		{"-", Key{Key: tcell.KeyRune, Rune: '-'}, "-"},
+	} {
+		k, err := ParseKey(test.spec)
+		if err != nil {
+			t.Errorf("failed parsing %q: %v", test.spec, err)
+			continue
+		}
+		if k != test.key {
+			t.Errorf("expected %q to parse as %+v, got %+v", test.spec, test.key, k)
+		}
+		if printed := k.String(); printed != test.printed {
+			t.Errorf("expected %q to print as %q, got %q", test.spec, test.printed, printed)
+		}
+		if again, err := ParseKey(k.String()); err != nil || again != k {
+			t.Errorf("%q did not survive printing and parsing again: %+v, %v", test.spec, again, err)
+		}
+	}
+	for _, spec := range []string{"", "Alt-", "Hyper-x", "Ctrl-Space-Bar"} {
+		if _, err := ParseKey(spec); err == nil {
+			t.Errorf("expected %q to be rejected", spec)
+		}
+	}
+}
+
+func TestParseSequence(t *testing.T) {
+	seq, err := ParseSequence("  Ctrl-X   ctrl-c ")
+	if err != nil {
+		t.Fatalf("failed parsing: %v", err)
+	}
+	if printed := seq.String(); printed != "Ctrl-X Ctrl-C" {
+		t.Errorf("expected Ctrl-X Ctrl-C, got %q", printed)
+	}
+	if _, err := ParseSequence(" "); err == nil {
+		t.Errorf("expected an empty binding to be rejected")
+	}
+}
+
+var testActions = []Action{
+	{Name: "top", Keys: []string{"g g", "Home"}},
+	{Name: "bottom", Keys: []string{"G"}},
+	{Name: "quit", Keys: []string{"Ctrl-X Ctrl-C"}},
+	{Name: "reply", Keys: []string{"r"}},
+}
+
+func TestNewConflicts(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		overrides map[string][]string
+		problem   string
+	}{
+		{"duplicate", map[string][]string{"reply": {"G"}}, `"G" is bound to both "bottom" and "reply"`},
+		{"prefix of another", map[string][]string{"reply": {"g"}}, `"g" (reply) is the start of a longer binding`},
+		{"extends another", map[string][]string{"quit": {"G q"}}, `"G q" (quit) starts with "G", which is bound to "bottom"`},
+		{"unknown action", map[string][]string{"fly": {"f"}}, `unknown action "fly"`},
+		{"unknown key", map[string][]string{"reply": {"Ctrl-Nope"}}, `action "reply": unknown key "Ctrl-Nope"`},
+	} {
+		_, err := New(testActions, test.overrides)
+		if err == nil || !strings.Contains(err.Error(), test.problem) {
+			t.Errorf("%s: expected %q, got %v", test.name, test.problem, err)
+		}
+		if err := Check(testActions, test.overrides); err == nil {
+			t.Errorf("%s: expected Check to report the problem", test.name)
+		}
+	}
+	// binding the same keys to an action twice is harmless
+	k, err := New(testActions, map[string][]string{"reply": {"R", "R", "Ctrl-R"}})
+	if err != nil {
+		t.Fatalf("failed creating keymap: %v", err)
+	}
+	if keys := k.Keys("reply"); len(keys) != 2 || keys[0].String() != "R" || keys[1].String() != "Ctrl-R" {
+		t.Errorf("expected the override to replace the default keys, got %v", keys)
+	}
+}
+
+// press creates the key event for a key written in the form accepted by
+// ParseKey.
+func press(t *testing.T, spec string) *tcell.EventKey {
+	k, err := ParseKey(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modifiers := tcell.ModNone
+	if k.Alt {
+		modifiers = tcell.ModAlt
+	}
+	return tcell.NewEventKey(k.Key, k.Rune, modifiers)
+}
+
+// expectMatch presses the keys in turn, checking the result of each.
+func expectMatch(t *testing.T, k *Keymap, presses ...interface{}) {
+	t.Helper()
+	for i := 0; i < len(presses); i += 3 {
+		spec, action, result := presses[i].(string), presses[i+1].(string), presses[i+2].(Result)
+		if gotAction, gotResult := k.Match(press(t, spec)); gotAction != action || gotResult != result {
+			t.Errorf("pressing %s: expected %q (%d), got %q (%d)", spec, action, result, gotAction, gotResult)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	k, err := New(testActions, nil)
+	if err != nil {
+		t.Fatalf("failed creating keymap: %v", err)
+	}
+	expectMatch(t, k,
+		"G", "bottom", Matched,
+		"g", "", Pending,
+		"g", "top", Matched,
+		"Home", "top", Matched,
+		"Ctrl-X", "", Pending,
+		"Ctrl-C", "quit", Matched,
+		// Ctrl-C is not bound on its own
+		"Ctrl-C", "", NoMatch,
+		"x", "", NoMatch,
+	)
+	// a key that doesn't continue the chord is tried on its own
+	expectMatch(t, k,
+		"Ctrl-X", "", Pending,
+		"G", "bottom", Matched,
+		"g", "", Pending,
+		"Ctrl-X", "", Pending,
+		"Ctrl-C", "quit", Matched,
+	)
+	// an abandoned chord doesn't linger
+	expectMatch(t, k,
+		"Ctrl-X", "", Pending,
+		"x", "", NoMatch,
+		"Ctrl-C", "", NoMatch,
+	)
+}
+
+func TestSubset(t *testing.T) {
+	k, err := New(testActions, map[string][]string{"top": {"g g"}})
+	if err != nil {
+		t.Fatalf("failed creating keymap: %v", err)
+	}
+	subset := k.Subset(testActions[:1])
+	if len(subset.Actions()) != 1 || len(subset.Keys("top")) != 1 || len(subset.Keys("bottom")) != 0 {
+		t.Fatalf("expected the subset to hold only the top action")
+	}
+	expectMatch(t, k, "g", "", Pending)
+	// the subset is not waiting for the rest of the chord begun in the keymap
+	expectMatch(t, subset,
+		"G", "", NoMatch,
+		"g", "", Pending,
+	)
+	expectMatch(t, k, "g", "top", Matched)
+	expectMatch(t, subset, "g", "top", Matched)
+}
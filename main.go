@@ -1,7 +1,6 @@
 package main
 
 import (
-	"crypto/tls"
 	"errors"
 	"flag"
 	"fmt"
@@ -12,16 +11,18 @@ import (
 	"runtime"
 	"time"
 
-	"github.com/0xAX/notificator"
 	"github.com/awnumar/memguard"
 	"github.com/gdamore/tcell"
 	"github.com/gdamore/tcell/views"
 	"github.com/pkg/profile"
 
+	forest "git.sr.ht/~whereswaldon/forest-go"
 	"git.sr.ht/~whereswaldon/forest-go/grove"
 	"git.sr.ht/~whereswaldon/forest-go/store"
-	"git.sr.ht/~whereswaldon/sprout-go"
 	"git.sr.ht/~whereswaldon/sprout-go/watch"
+	"git.sr.ht/~whereswaldon/wisteria/notify"
+	"git.sr.ht/~whereswaldon/wisteria/searchindex"
+	"git.sr.ht/~whereswaldon/wisteria/socks"
 	"git.sr.ht/~whereswaldon/wisteria/widgets"
 	wistTcell "git.sr.ht/~whereswaldon/wisteria/widgets/tcell"
 )
@@ -31,8 +32,14 @@ var (
 	commit  = "unknown"
 )
 
-func CheckNotify() {
-	if runtime.GOOS == "linux" {
+// CheckNotify warns if the notification backends in use are missing
+// something that they need.
+func CheckNotify(backends []string) {
+	desktop := false
+	for _, backend := range backends {
+		desktop = desktop || backend == notify.BackendDesktop
+	}
+	if desktop && runtime.GOOS == "linux" {
 		if _, err := exec.LookPath("notify-send"); err != nil {
 			log.Println("WARNING: desktop notifications require `notify-send` to be installed")
 		}
@@ -59,11 +66,34 @@ func main() {
 		return
 	}
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "search":
+			if err := RunSearchCommand(os.Args[2:], defaultGrovePath, os.Stdout); err != nil {
+				if errors.Is(err, flag.ErrHelp) {
+					return
+				}
+				log.Fatalf("Search failed: %v", err)
+			}
+			return
+		case "new-community":
+			prompter := NewStdoutPrompter(os.Stdin, int(os.Stdin.Fd()), os.Stdout)
+			if err := RunNewCommunityCommand(os.Args[2:], defaultConfig, defaultGrovePath, prompter, os.Stdout); err != nil {
+				if errors.Is(err, flag.ErrHelp) {
+					return
+				}
+				log.Fatalf("Creating community failed: %v", err)
+			}
+			return
+		}
+	}
+
 	// declare flags
 	configpath := flag.String("config", defaultConfig, "the configuration file to load")
 	grovepath := flag.String("grove", defaultGrovePath, "path to the grove in use (directory of arbor history)")
 	profiling := flag.Bool("profile", false, "enable CPU profiling (pprof file location will be logged)")
-	insecure := flag.Bool("insecure", false, "disable TLS certificate validation when dialing relay addresses")
+	insecure := flag.Bool("insecure", false, "disable TLS certificate validation when dialing relay addresses given as arguments")
+	proxy := flag.String("proxy", "", "SOCKS5 proxy to dial relays through, like socks5://127.0.0.1:9050 for Tor (overrides the Proxy in the configuration file)")
 	nogpg := flag.Bool("nogpg", false, "disable the use of GPG for cryptography even when it is installed")
 	testStartup := flag.Bool("test-startup", false, "run all the way through initializing the application, then exit gracefully. This flag is useful for automated testing of the startup configuration")
 	printVersion := flag.Bool("version", false, "print version information and exit")
@@ -75,11 +105,20 @@ func main() {
 		fmt.Fprintf(flag.CommandLine.Output(), `Usage of %s:
 
 %s [flags] [relay-address [relay-address]...]
+%s search [search-flags] [term...]
+%s new-community [new-community-flags] [name]
 
 Where [relay-address] is the IP:PORT or FQDN:PORT of a sprout relay
-and [flags] are among those listed below:
-
-`, executable, executable)
+to connect to in addition to the Relays in the configuration file,
+and [flags] are among those listed below. Relays in the configuration
+file can instead trust a custom CA bundle (CAFile), present a client
+certificate (CertFile and KeyFile), or pin their certificate on first
+use (TLS set to "tofu"). Relays are dialed through the SOCKS5 Proxy
+in the configuration file, if any, unless they set their own Proxy
+(or "direct" to bypass it). Run "%s search -h" or
+"%s new-community -h" to see the flags of those subcommands.
+
+`, executable, executable, executable, executable, executable, executable)
 		flag.PrintDefaults()
 	}
 
@@ -89,9 +128,6 @@ and [flags] are among those listed below:
 		fmt.Printf("%s version: %s commit: %s\n", os.Args[0], version, commit)
 		return
 	}
-	// check whether we can send desktop notifications and warn if we can't
-	CheckNotify()
-
 	// ensure the grove path that we're working with actually exists
 	if err := os.MkdirAll(*grovepath, 0770); err != nil {
 		log.Fatalf("Failed creating the grove path: %v", err)
@@ -138,17 +174,7 @@ and [flags] are among those listed below:
 	}
 
 	// choose whether to enable gpg support.
-	if *nogpg {
-		// the flag to disable it should always win
-		config.UseGPG = TristateFalse
-	} else if config.UseGPG == TristateUndefined {
-		// use gpg if it's available and the user hasn't opted out
-		if GPGAvailable() {
-			config.UseGPG = TristateTrue
-		} else {
-			config.UseGPG = TristateFalse
-		}
-	}
+	config.ChooseGPG(*nogpg)
 
 	wizard := &Wizard{
 		Config:   config,
@@ -169,7 +195,7 @@ and [flags] are among those listed below:
 			log.Printf("Choosing not to overwrite existing config file %s", *configpath)
 		}
 	}
-	if config.UseGPG == TristateFalse && config.passphraseEnclave == nil {
+	if config.NeedsPassphrase() {
 		prompt := "Please enter your arbor identity passphrase (hit enter when finished):"
 		if err := wizard.ConfigurePassphrase(prompt); err != nil {
 			log.Fatalf("Failed to get arbor passphrase: %v", err)
@@ -179,42 +205,100 @@ and [flags] are among those listed below:
 	// create the observable message storage abstraction that sprout workers use
 	subscriberStore := store.NewArchive(cacheStore)
 
-	// dial relay address (if provided)
-	done := make(chan struct{})
-	for _, address := range flag.Args() {
-		tlsConfig := (*tls.Config)(nil)
-		if *insecure {
-			tlsConfig = &tls.Config{
-				InsecureSkipVerify: true,
-			}
+	// keep a full-text index of the grove. Every node that arrives, whether from
+	// a relay or through the grove watcher below, passes through subscriberStore.
+	searchIndex, err := searchindex.Open(config.SearchIndexDirectory())
+	if err != nil {
+		log.Printf("Search will be limited to loaded messages: %v", err)
+	} else {
+		if searchIndex.ReadOnly {
+			log.Printf("Search index is in use by another process; replies indexed now will not be saved")
 		}
-		sprout.LaunchSupervisedWorker(done, address, subscriberStore, tlsConfig, log.New(log.Writer(), address+" ", log.Flags()))
+		subscriberStore.SubscribeToNewMessages(func(node forest.Node) {
+			// cannot block in subscription
+			go func() {
+				if reply, ok := node.(*forest.Reply); ok {
+					if err := searchIndex.Add(reply, subscriberStore); err != nil {
+						log.Printf("Failed indexing %s: %v", reply.ID(), err)
+					}
+				}
+			}()
+		})
+		go func() {
+			added, err := searchIndex.Build(*grovepath, subscriberStore)
+			if err != nil {
+				log.Printf("Failed updating search index: %v", err)
+			}
+			log.Printf("Added %d replies to the search index", added)
+		}()
+	}
+
+	// set up notifications, checking whether we can send them and warning if we can't
+	notifier, err := config.Notifier()
+	if err != nil {
+		log.Fatalf("Failed to configure notifications: %v", err)
 	}
+	CheckNotify(config.NotifierBackends())
 
-	// set up desktop notifications
-	notify := notificator.New(notificator.Options{
-		AppName: "Arbor",
-	})
+	keys, err := config.Keys()
+	if err != nil {
+		log.Fatalf("Failed to load key bindings: %v", err)
+	}
 
 	// build an widget/application from existing views and services
 	app := new(wistTcell.Application)
-	hw, err := NewHistoryWidget(app, subscriberStore, config, notify)
+	hw, err := NewHistoryWidget(app, subscriberStore, config, notifier, keys.Subset(HistoryActions))
 	if err != nil {
 		log.Fatalf("Failed to create history widget: %v", err)
 	}
-	editorLayer := widgets.NewEphemeralEditor(hw)
-
-	titlebar := views.NewSimpleStyledTextBar()
-	titlebar.SetLeft("%Swisteria")
-	titlebar.SetRight("%Sarrows or vi to move; enter to reply; c for new convo")
-	titlebar.SetStyle(tcell.StyleDefault.Reverse(true))
-
+	hw.Index = searchIndex
+	hw.SetGuide(gettingStarted(keys, *grovepath))
+	conversations := NewConversationsWidget(hw)
+	hw.Watch(conversations)
+	sidebar := widgets.NewSidebar(hw, conversations, keys.Subset(SidebarActions))
+	editorLayer := widgets.NewEphemeralEditor(sidebar)
+
+	titlebar := widgets.NewTitleBar(helpHint(keys))
 	statusbar := widgets.NewStatusBar()
-	// subscribe the status bar to events from the history widget
+	// subscribe the title and status bars to events from the history widget
+	hw.Watch(titlebar)
 	hw.Watch(statusbar)
-	hw.UpdateCursor() // set initial statusbar state
-
-	switcher := widgets.NewSwitcher(app, editorLayer, logWidget)
+	hw.UpdateCursor() // set initial title and statusbar state
+	hw.AnnounceScope()
+	hw.AnnounceIdentity()
+
+	switcher := widgets.NewSwitcher(app, editorLayer, logWidget, keys.Subset(GlobalActions))
+	switcher.AddToggle(ActionToggleDrafts, NewDraftsWidget(hw))
+	communities := NewCommunitiesWidget(hw)
+	hw.Watch(communities)
+	switcher.AddToggle(ActionToggleCommunities, communities)
+	switcher.AddToggle(ActionToggleIdentities, NewIdentitiesWidget(hw))
+	switcher.AddToggle(ActionToggleNotifications, NewNotificationsWidget(hw.Dispatcher))
+	switcher.AddToggle(ActionToggleHelp, widgets.NewHelp(keys))
+	pins, err := LoadPins(config.PinsPath())
+	if err != nil {
+		log.Fatalf("Failed to load relay certificate pins: %v", err)
+	}
+	relays := NewRelayManager(subscriberStore, *configpath, pins, config.Relays)
+	relays.Proxy = config.Proxy
+	if *proxy != "" {
+		if _, err := socks.FromURL(*proxy); err != nil {
+			log.Fatalf("Invalid -proxy: %v", err)
+		}
+		relays.Proxy = *proxy
+	}
+	relays.OnChange = func() {
+		app.PostFunc(hw.AnnounceRelays)
+	}
+	relays.OnUntrusted = func(mismatch *FingerprintMismatchError) {
+		app.PostFunc(func() {
+			hw.EmitTrustRequest(mismatch)
+		})
+	}
+	hw.RelayManager = relays
+	switcher.AddToggle(ActionToggleRelays, NewRelaysWidget(hw, relays))
+	hw.Picker = NewCommunityPicker(hw)
+	switcher.AddWidget(hw.Picker)
 
 	layout := views.NewBoxLayout(views.Vertical)
 	layout.AddWidget(titlebar, 0)
@@ -222,6 +306,14 @@ and [flags] are among those listed below:
 	layout.AddWidget(statusbar, 0)
 	app.SetRootWidget(layout)
 
+	// dial the configured relays and any relay addresses provided
+	for _, relay := range config.StartupRelays(flag.Args(), *insecure) {
+		if err := relays.Connect(relay); err != nil {
+			log.Printf("Failed connecting to relay: %v", err)
+		}
+	}
+	hw.AnnounceRelays()
+
 	// watch the cwd for new nodes from other sources
 	logger := log.New(log.Writer(), "", log.LstdFlags|log.Lshortfile)
 	if _, err := watch.Watch(*grovepath, logger, hw.ReadMessageFile); err != nil {
@@ -245,8 +337,18 @@ and [flags] are among those listed below:
 	}
 
 	// run the TUI
-	if e := app.Run(); e != nil {
-		log.Println(e.Error())
+	runErr := app.Run()
+	relays.Close()
+	if err := hw.Unread.Save(); err != nil {
+		log.Printf("Failed saving read markers: %v", err)
+	}
+	if searchIndex != nil {
+		if err := searchIndex.Close(); err != nil {
+			log.Printf("Failed saving search index: %v", err)
+		}
+	}
+	if runErr != nil {
+		log.Println(runErr.Error())
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"git.sr.ht/~whereswaldon/wisteria/notify"
+	"git.sr.ht/~whereswaldon/wisteria/widgets"
+	"github.com/gdamore/tcell"
+)
+
+// NotificationsWidget lists the notifications dispatched by the history
+// widget, newest first, including those that were suppressed. Esc or q
+// dismisses it.
+type NotificationsWidget struct {
+	*widgets.List
+	Dispatcher *notify.Dispatcher
+}
+
+// NewNotificationsWidget creates a widget listing the history of the
+// dispatcher.
+func NewNotificationsWidget(dispatcher *notify.Dispatcher) *NotificationsWidget {
+	n := &NotificationsWidget{
+		List:       widgets.NewList(),
+		Dispatcher: dispatcher,
+	}
+	n.Refresh()
+	return n
+}
+
+// Refresh rebuilds the listing from the dispatcher's history.
+func (n *NotificationsWidget) Refresh() {
+	records := n.Dispatcher.History()
+	suppressed := 0
+	for _, record := range records {
+		if record.Suppressed() {
+			suppressed++
+		}
+	}
+	status := "on"
+	if n.Dispatcher.DoNotDisturb() {
+		status = "suppressed by do not disturb"
+	}
+	items := make([]string, 0, len(records)+3)
+	items = append(items,
+		"Notifications (Esc to close)",
+		fmt.Sprintf("notifications are %s; %d of %d suppressed", status, suppressed, len(records)),
+		"")
+	for i := len(records) - 1; i >= 0; i-- {
+		items = append(items, describeRecord(records[i]))
+	}
+	if len(records) == 0 {
+		items = append(items, "No messages have matched the notification rules yet")
+	}
+	n.SetItems(items)
+}
+
+// describeRecord renders a notification as several lines.
+func describeRecord(record notify.Record) string {
+	outcome := record.Outcome
+	if outcome == "" {
+		outcome = "waiting"
+	}
+	return fmt.Sprintf("%s  %s from %s [%s, %s]\n  %s",
+		record.Time.Local().Format("Jan 02 15:04"), record.Reason, record.Author,
+		record.Urgency, outcome, strings.SplitN(record.Body, "\n", 2)[0])
+}
+
+// Draw refreshes the listing and then draws it.
+func (n *NotificationsWidget) Draw() {
+	n.Refresh()
+	n.List.Draw()
+}
+
+// HandleEvent dismisses the listing on Esc or q and scrolls it otherwise.
+func (n *NotificationsWidget) HandleEvent(ev tcell.Event) bool {
+	if event, ok := ev.(*tcell.EventKey); ok {
+		if event.Key() == tcell.KeyEscape || (event.Key() == tcell.KeyRune && event.Rune() == 'q') {
+			n.PostEvent(widgets.NewEventShowContent(n))
+			return true
+		}
+	}
+	return n.List.HandleEvent(ev)
+}
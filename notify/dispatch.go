@@ -0,0 +1,294 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultInterval is the shortest time between notifications unless the
+	// Settings choose another
+	DefaultInterval = 10 * time.Second
+	// maxHistory is the number of records kept in a Dispatcher's history
+	maxHistory = 500
+	// maxBatchLines is the number of messages quoted in a combined notification
+	maxBatchLines = 3
+)
+
+// QuietHours is a period of the day during which notifications are held back.
+// It may span midnight.
+type QuietHours struct {
+	// Start and End are offsets from midnight
+	Start, End time.Duration
+}
+
+// ParseQuietHours parses a period written like "22:00-07:00".
+func ParseQuietHours(spec string) (QuietHours, error) {
+	parts := strings.Split(spec, "-")
+	if len(parts) != 2 {
+		return QuietHours{}, fmt.Errorf("quiet hours %q should look like 22:00-07:00", spec)
+	}
+	var offsets [2]time.Duration
+	for i, part := range parts {
+		t, err := time.Parse("15:04", strings.TrimSpace(part))
+		if err != nil {
+			return QuietHours{}, fmt.Errorf("quiet hours %q should look like 22:00-07:00", spec)
+		}
+		offsets[i] = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	return QuietHours{Start: offsets[0], End: offsets[1]}, nil
+}
+
+// Contains reports whether the time of day of t falls within the period.
+func (q QuietHours) Contains(t time.Time) bool {
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	if q.Start <= q.End {
+		return offset >= q.Start && offset < q.End
+	}
+	return offset >= q.Start || offset < q.End
+}
+
+// Event is a message that matched the notification rules.
+type Event struct {
+	Match
+	Author, Body string
+	Time         time.Time
+}
+
+// Outcomes of an Event
+const (
+	// OutcomeSent events were presented in a notification of their own
+	OutcomeSent = "sent"
+	// OutcomeCombined events were presented in a notification together with
+	// other events
+	OutcomeCombined = "combined"
+	// OutcomeDoNotDisturb events were suppressed by do-not-disturb
+	OutcomeDoNotDisturb = "do not disturb"
+	// OutcomeQuietHours events were suppressed by quiet hours
+	OutcomeQuietHours = "quiet hours"
+	// OutcomeFailed events could not be presented
+	OutcomeFailed = "failed"
+)
+
+// Record is an Event along with what became of it.
+type Record struct {
+	Event
+	// Outcome is one of the Outcome constants, or empty while the event waits
+	// to be combined with others
+	Outcome string
+}
+
+// Suppressed reports whether the event was never presented to the user.
+func (r Record) Suppressed() bool {
+	return r.Outcome == OutcomeDoNotDisturb || r.Outcome == OutcomeQuietHours
+}
+
+// Dispatcher decides when events are presented by its Notifier. It sends at
+// most one notification per Interval, combining the events that arrive in
+// between, and suppresses events while do-not-disturb is enabled or during
+// quiet hours. Every event is kept in its history.
+type Dispatcher struct {
+	Notifier   Notifier
+	Interval   time.Duration
+	QuietHours []QuietHours
+	// Run runs flushes of combined events that happen after a delay. It can
+	// be used to move them onto another goroutine. By default they are run
+	// on the goroutine of a timer.
+	Run func(func())
+	// OnError is called with any error from the Notifier
+	OnError func(error)
+
+	sync.Mutex
+	dnd      bool
+	history  []*Record
+	pending  []*Record
+	lastSent time.Time
+	timer    *time.Timer
+}
+
+// NewDispatcher creates a Dispatcher presenting events through the notifier
+// with the interval and quiet hours chosen by the settings.
+func NewDispatcher(settings Settings, notifier Notifier) (*Dispatcher, error) {
+	d := &Dispatcher{
+		Notifier: notifier,
+		Interval: DefaultInterval,
+		Run:      func(f func()) { f() },
+		OnError:  func(error) {},
+	}
+	if settings.Interval != "" {
+		interval, err := time.ParseDuration(settings.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid interval: %w", err)
+		}
+		d.Interval = interval
+	}
+	for _, spec := range settings.QuietHours {
+		quiet, err := ParseQuietHours(spec)
+		if err != nil {
+			return nil, err
+		}
+		d.QuietHours = append(d.QuietHours, quiet)
+	}
+	return d, nil
+}
+
+// SetDoNotDisturb enables or disables do-not-disturb.
+func (d *Dispatcher) SetDoNotDisturb(enabled bool) {
+	d.Lock()
+	defer d.Unlock()
+	d.dnd = enabled
+}
+
+// DoNotDisturb reports whether do-not-disturb is enabled.
+func (d *Dispatcher) DoNotDisturb() bool {
+	d.Lock()
+	defer d.Unlock()
+	return d.dnd
+}
+
+// Quiet reports whether t falls within the quiet hours.
+func (d *Dispatcher) Quiet(t time.Time) bool {
+	for _, quiet := range d.QuietHours {
+		if quiet.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// History returns copies of the recorded events, oldest first.
+func (d *Dispatcher) History() []Record {
+	d.Lock()
+	defer d.Unlock()
+	records := make([]Record, len(d.history))
+	for i, record := range d.history {
+		records[i] = *record
+	}
+	return records
+}
+
+// Dispatch records the event and presents it immediately if no notification
+// was sent within the Interval. Otherwise it is combined with any others that
+// arrive before the Interval elapses.
+func (d *Dispatcher) Dispatch(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	d.Lock()
+	defer d.Unlock()
+	record := &Record{Event: event}
+	d.history = append(d.history, record)
+	if len(d.history) > maxHistory {
+		d.history = d.history[len(d.history)-maxHistory:]
+	}
+	switch {
+	case d.dnd:
+		record.Outcome = OutcomeDoNotDisturb
+		return
+	case d.Quiet(event.Time):
+		record.Outcome = OutcomeQuietHours
+		return
+	}
+	d.pending = append(d.pending, record)
+	if d.timer != nil {
+		return
+	}
+	if wait := d.Interval - time.Since(d.lastSent); wait > 0 {
+		d.timer = time.AfterFunc(wait, func() {
+			d.Run(d.flush)
+		})
+		return
+	}
+	d.flushLocked()
+}
+
+// flush presents the pending events.
+func (d *Dispatcher) flush() {
+	d.Lock()
+	defer d.Unlock()
+	d.timer = nil
+	d.flushLocked()
+}
+
+// flushLocked presents the pending events. The caller must hold the lock.
+func (d *Dispatcher) flushLocked() {
+	if len(d.pending) == 0 {
+		return
+	}
+	pending := d.pending
+	d.pending = nil
+	d.lastSent = time.Now()
+	outcome := OutcomeSent
+	if len(pending) > 1 {
+		outcome = OutcomeCombined
+	}
+	if err := d.Notifier.Notify(combine(pending)); err != nil {
+		outcome = OutcomeFailed
+		d.OnError(err)
+	}
+	for _, record := range pending {
+		record.Outcome = outcome
+	}
+}
+
+// reasonPlurals are the plural forms of the reasons of the built-in rules
+var reasonPlurals = map[string]string{
+	kindReasons[KindMention]:  "mentions",
+	kindReasons[KindReply]:    "replies",
+	kindReasons[KindFollowed]: "messages in followed conversations",
+	kindReasons[KindKeyword]:  "keyword matches",
+}
+
+// combine describes the events in a single notification, like
+// "5 new mentions from 3 people".
+func combine(records []*Record) Notification {
+	if len(records) == 1 {
+		event := records[0].Event
+		return Notification{
+			Title:   fmt.Sprintf("Arbor %s from %s", event.Reason, event.Author),
+			Body:    event.Body,
+			Urgency: event.Urgency,
+		}
+	}
+	reasons := make(map[string]struct{})
+	authors := make(map[string]struct{})
+	n := Notification{Urgency: UrgencyLow}
+	for _, record := range records {
+		reasons[record.Reason] = struct{}{}
+		authors[record.Author] = struct{}{}
+		if record.Urgency.rank() > n.Urgency.rank() {
+			n.Urgency = record.Urgency
+		}
+	}
+	noun := "messages"
+	if len(reasons) == 1 {
+		if plural, ok := reasonPlurals[records[0].Reason]; ok {
+			noun = plural
+		}
+	}
+	people := "1 person"
+	if len(authors) != 1 {
+		people = fmt.Sprintf("%d people", len(authors))
+	}
+	n.Title = fmt.Sprintf("Arbor: %d new %s from %s", len(records), noun, people)
+	lines := []string{}
+	start := len(records) - maxBatchLines
+	if start < 0 {
+		start = 0
+	}
+	for _, record := range records[start:] {
+		lines = append(lines, record.Author+": "+firstLine(record.Body))
+	}
+	if start > 0 {
+		lines = append(lines, fmt.Sprintf("and %d more", start))
+	}
+	n.Body = strings.Join(lines, "\n")
+	return n
+}
+
+// firstLine returns the first line of the text.
+func firstLine(text string) string {
+	return strings.SplitN(text, "\n", 2)[0]
+}
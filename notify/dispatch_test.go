@@ -0,0 +1,213 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder is a Notifier that records its notifications
+type recorder struct {
+	sync.Mutex
+	sent []Notification
+	err  error
+}
+
+func (r *recorder) Notify(n Notification) error {
+	r.Lock()
+	defer r.Unlock()
+	r.sent = append(r.sent, n)
+	return r.err
+}
+
+func (r *recorder) notifications() []Notification {
+	r.Lock()
+	defer r.Unlock()
+	return append([]Notification(nil), r.sent...)
+}
+
+func TestParseQuietHours(t *testing.T) {
+	overnight, err := ParseQuietHours("22:00 - 07:30")
+	if err != nil {
+		t.Fatalf("failed parsing quiet hours: %v", err)
+	}
+	if overnight.Start != 22*time.Hour || overnight.End != 7*time.Hour+30*time.Minute {
+		t.Errorf("parsed unexpected quiet hours %+v", overnight)
+	}
+	afternoon, err := ParseQuietHours("13:00-14:00")
+	if err != nil {
+		t.Fatalf("failed parsing quiet hours: %v", err)
+	}
+	for _, test := range []struct {
+		quiet  QuietHours
+		clock  string
+		inside bool
+	}{
+		{overnight, "23:15", true},
+		{overnight, "03:00", true},
+		{overnight, "07:30", false},
+		{overnight, "12:00", false},
+		{afternoon, "13:00", true},
+		{afternoon, "14:00", false},
+		{afternoon, "02:00", false},
+	} {
+		clock, _ := time.Parse("15:04", test.clock)
+		if test.quiet.Contains(clock) != test.inside {
+			t.Errorf("expected %s within %+v to be %v", test.clock, test.quiet, test.inside)
+		}
+	}
+	for _, spec := range []string{"22:00", "22:00-", "10pm-7am", "22:00-07:00-08:00"} {
+		if _, err := ParseQuietHours(spec); err == nil {
+			t.Errorf("expected %q to be rejected", spec)
+		}
+	}
+}
+
+func TestNewDispatcher(t *testing.T) {
+	d, err := NewDispatcher(Settings{Interval: "30s", QuietHours: []string{"22:00-07:00"}}, nil)
+	if err != nil {
+		t.Fatalf("failed creating dispatcher: %v", err)
+	}
+	if d.Interval != 30*time.Second || len(d.QuietHours) != 1 {
+		t.Errorf("dispatcher does not reflect its settings: %+v", d)
+	}
+	for _, settings := range []Settings{{Interval: "soon"}, {QuietHours: []string{"night"}}} {
+		if _, err := NewDispatcher(settings, nil); err == nil {
+			t.Errorf("expected %+v to be rejected", settings)
+		}
+		if err := Check(settings); err == nil {
+			t.Errorf("expected Check to reject %+v", settings)
+		}
+	}
+}
+
+func TestDispatchCombinesWithinInterval(t *testing.T) {
+	notifier := &recorder{}
+	d, err := NewDispatcher(Settings{Interval: "50ms"}, notifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flushed := make(chan struct{})
+	d.Run = func(flush func()) {
+		flush()
+		close(flushed)
+	}
+	mention := Match{Reason: kindReasons[KindMention], Urgency: UrgencyNormal}
+	d.Dispatch(Event{Match: mention, Author: "alice", Body: "first"})
+	if sent := notifier.notifications(); len(sent) != 1 || sent[0].Title != "Arbor Mention from alice" || sent[0].Body != "first" {
+		t.Fatalf("expected the first event to be sent at once, got %+v", sent)
+	}
+	d.Dispatch(Event{Match: mention, Author: "bob", Body: "second\nmore"})
+	d.Dispatch(Event{Match: Match{Reason: kindReasons[KindMention], Urgency: UrgencyCritical}, Author: "alice", Body: "third"})
+	if sent := notifier.notifications(); len(sent) != 1 {
+		t.Fatalf("expected events within the interval to wait, got %+v", sent)
+	}
+	select {
+	case <-flushed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("pending events were never flushed")
+	}
+	sent := notifier.notifications()
+	if len(sent) != 2 {
+		t.Fatalf("expected the pending events to be combined into one notification, got %+v", sent)
+	}
+	combined := Notification{
+		Title:   "Arbor: 2 new mentions from 2 people",
+		Body:    "bob: second\nalice: third",
+		Urgency: UrgencyCritical,
+	}
+	if sent[1] != combined {
+		t.Errorf("expected %+v, got %+v", combined, sent[1])
+	}
+	outcomes := []string{}
+	for _, record := range d.History() {
+		outcomes = append(outcomes, record.Outcome)
+	}
+	if expected := []string{OutcomeSent, OutcomeCombined, OutcomeCombined}; fmt.Sprint(outcomes) != fmt.Sprint(expected) {
+		t.Errorf("expected outcomes %v, got %v", expected, outcomes)
+	}
+}
+
+func TestDispatchSuppresses(t *testing.T) {
+	notifier := &recorder{}
+	d, err := NewDispatcher(Settings{}, notifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.SetDoNotDisturb(true)
+	if !d.DoNotDisturb() {
+		t.Errorf("expected do-not-disturb to be enabled")
+	}
+	d.Dispatch(Event{Author: "alice"})
+	d.SetDoNotDisturb(false)
+	d.QuietHours = []QuietHours{{Start: 0, End: 24 * time.Hour}}
+	d.Dispatch(Event{Author: "bob"})
+	if sent := notifier.notifications(); len(sent) != 0 {
+		t.Errorf("expected no notifications, got %+v", sent)
+	}
+	history := d.History()
+	if len(history) != 2 || history[0].Outcome != OutcomeDoNotDisturb || history[1].Outcome != OutcomeQuietHours {
+		t.Fatalf("expected suppressed events in the history, got %+v", history)
+	}
+	for _, record := range history {
+		if !record.Suppressed() {
+			t.Errorf("expected %+v to be suppressed", record)
+		}
+	}
+}
+
+func TestDispatchFailure(t *testing.T) {
+	notifier := &recorder{err: fmt.Errorf("no display")}
+	d, err := NewDispatcher(Settings{}, notifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reported error
+	d.OnError = func(err error) { reported = err }
+	d.Dispatch(Event{Author: "alice"})
+	if reported == nil || !strings.Contains(reported.Error(), "no display") {
+		t.Errorf("expected the failure to be reported, got %v", reported)
+	}
+	if history := d.History(); len(history) != 1 || history[0].Outcome != OutcomeFailed || history[0].Suppressed() {
+		t.Errorf("expected a failed record, got %+v", history)
+	}
+}
+
+func TestHistoryIsBounded(t *testing.T) {
+	d, err := NewDispatcher(Settings{}, &recorder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.SetDoNotDisturb(true)
+	for i := 0; i < maxHistory+10; i++ {
+		d.Dispatch(Event{Author: fmt.Sprint(i)})
+	}
+	history := d.History()
+	if len(history) != maxHistory || history[0].Author != "10" {
+		t.Errorf("expected the newest %d records, got %d starting with %q", maxHistory, len(history), history[0].Author)
+	}
+}
+
+func TestCombineManyEvents(t *testing.T) {
+	records := []*Record{}
+	for i, reason := range []string{"Mention", "Reply", "Mention", "Mention", "Reply"} {
+		records = append(records, &Record{Event: Event{
+			Match:  Match{Reason: reason, Urgency: UrgencyLow},
+			Author: "alice",
+			Body:   fmt.Sprintf("message %d", i),
+		}})
+	}
+	n := combine(records)
+	if n.Title != "Arbor: 5 new messages from 1 person" {
+		t.Errorf("unexpected title %q", n.Title)
+	}
+	expected := "alice: message 2\nalice: message 3\nalice: message 4\nand 2 more"
+	if n.Body != expected {
+		t.Errorf("expected body %q, got %q", expected, n.Body)
+	}
+	if n.Urgency != UrgencyLow {
+		t.Errorf("expected low urgency, got %q", n.Urgency)
+	}
+}
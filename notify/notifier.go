@@ -0,0 +1,272 @@
+package notify
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/0xAX/notificator"
+)
+
+// Notification is a message presented to the user.
+type Notification struct {
+	Title, Body string
+	Urgency     Urgency
+}
+
+// Notifier presents notifications to the user.
+type Notifier interface {
+	Notify(n Notification) error
+}
+
+// Names of the available Notifier backends
+const (
+	// BackendDesktop sends desktop notifications, which requires notify-send
+	// on Linux
+	BackendDesktop = "desktop"
+	// BackendBell rings the terminal bell
+	BackendBell = "bell"
+	// BackendOSC9 sends the OSC 9 escape sequence understood by iTerm2,
+	// Windows Terminal and others
+	BackendOSC9 = "osc9"
+	// BackendOSC777 sends the OSC 777 escape sequence understood by
+	// rxvt-unicode, foot, WezTerm and others
+	BackendOSC777 = "osc777"
+	// BackendTmux displays a message in the tmux status line
+	BackendTmux = "tmux"
+	// BackendCommand runs a user-specified command
+	BackendCommand = "command"
+)
+
+// Backends lists the name of every backend
+var Backends = []string{BackendDesktop, BackendBell, BackendOSC9, BackendOSC777, BackendTmux, BackendCommand}
+
+// Placeholders replaced within the arguments of the command run by BackendCommand
+const (
+	PlaceholderTitle   = "{title}"
+	PlaceholderBody    = "{body}"
+	PlaceholderUrgency = "{urgency}"
+)
+
+// DefaultBackends returns the desktop backend where a graphical display is
+// likely to be available, and the terminal bell otherwise.
+func DefaultBackends() []string {
+	if runtime.GOOS == "linux" || runtime.GOOS == "freebsd" || runtime.GOOS == "openbsd" {
+		graphical := os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != ""
+		if !graphical || os.Getenv("SSH_CONNECTION") != "" {
+			return []string{BackendBell}
+		}
+	}
+	return []string{BackendDesktop}
+}
+
+// Options configure the backends created by NewNotifier.
+type Options struct {
+	// AppName identifies the application in desktop notifications
+	AppName string
+	// Terminal receives the output of the terminal backends
+	Terminal io.Writer
+	// Command is run by BackendCommand, with any placeholders in its arguments
+	// replaced
+	Command []string
+}
+
+// CheckBackends reports whether every named backend exists and has the
+// options that it requires.
+func CheckBackends(backends []string, options Options) error {
+	problems := []string{}
+	for _, backend := range backends {
+		known := false
+		for _, name := range Backends {
+			known = known || name == backend
+		}
+		switch {
+		case !known:
+			problems = append(problems, fmt.Sprintf("unknown notifier %q", backend))
+		case backend == BackendCommand && len(options.Command) == 0:
+			problems = append(problems, fmt.Sprintf("notifier %q requires a command", backend))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// NewNotifier creates a Notifier that presents each notification through
+// every named backend.
+func NewNotifier(backends []string, options Options) (Notifier, error) {
+	if err := CheckBackends(backends, options); err != nil {
+		return nil, err
+	}
+	if options.Terminal == nil {
+		options.Terminal = os.Stdout
+	}
+	all := Multi{}
+	for _, backend := range backends {
+		switch backend {
+		case BackendDesktop:
+			all = append(all, &Desktop{notificator.New(notificator.Options{AppName: options.AppName})})
+		case BackendBell:
+			all = append(all, &Bell{Out: options.Terminal})
+		case BackendOSC9:
+			all = append(all, &OSC{Out: options.Terminal, Format: OSC9})
+		case BackendOSC777:
+			all = append(all, &OSC{Out: options.Terminal, Format: OSC777})
+		case BackendTmux:
+			all = append(all, Tmux{})
+		case BackendCommand:
+			all = append(all, Command{Args: options.Command})
+		}
+	}
+	return all, nil
+}
+
+// Multi presents notifications through several Notifiers.
+type Multi []Notifier
+
+// Notify presents the notification through every Notifier, even if some of
+// them fail.
+func (m Multi) Notify(n Notification) error {
+	problems := []string{}
+	for _, notifier := range m {
+		if err := notifier.Notify(n); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Desktop sends desktop notifications.
+type Desktop struct {
+	*notificator.Notificator
+}
+
+// Notify sends a desktop notification.
+func (d *Desktop) Notify(n Notification) error {
+	urgency := n.Urgency
+	if urgency == "" {
+		urgency = UrgencyNormal
+	}
+	if err := d.Push(n.Title, n.Body, "", string(urgency)); err != nil {
+		return fmt.Errorf("failed sending desktop notification: %w", err)
+	}
+	return nil
+}
+
+// Bell rings the terminal bell.
+type Bell struct {
+	Out io.Writer
+}
+
+// Notify rings the bell.
+func (b *Bell) Notify(n Notification) error {
+	if _, err := io.WriteString(b.Out, "\a"); err != nil {
+		return fmt.Errorf("failed ringing bell: %w", err)
+	}
+	return nil
+}
+
+// Formats of OSC notification escape sequences
+const (
+	OSC9   = "\x1b]9;%[2]s\a"
+	OSC777 = "\x1b]777;notify;%[1]s;%[2]s\a"
+)
+
+// OSC sends notifications as terminal escape sequences. Within tmux, the
+// sequence is passed through to the outer terminal.
+type OSC struct {
+	Out io.Writer
+	// Format is a format string like OSC9, receiving the title and the body
+	Format string
+}
+
+// Notify writes the escape sequence for the notification.
+func (o *OSC) Notify(n Notification) error {
+	// a semicolon would end the title of an OSC 777 notification
+	title := strings.ReplaceAll(sanitize(n.Title), ";", ":")
+	body := sanitize(n.Body)
+	if o.Format == OSC9 {
+		body = title + ": " + body
+	}
+	sequence := fmt.Sprintf(o.Format, title, body)
+	if os.Getenv("TMUX") != "" {
+		sequence = "\x1bPtmux;" + strings.ReplaceAll(sequence, "\x1b", "\x1b\x1b") + "\x1b\\"
+	}
+	if _, err := io.WriteString(o.Out, sequence); err != nil {
+		return fmt.Errorf("failed writing notification escape sequence: %w", err)
+	}
+	return nil
+}
+
+// sanitize replaces control characters, which could otherwise end an escape
+// sequence early, with spaces.
+func sanitize(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || (r >= 0x7f && r < 0xa0) {
+			return ' '
+		}
+		return r
+	}, text)
+}
+
+// Tmux displays notifications in the tmux status line.
+type Tmux struct{}
+
+// Notify displays the notification with `tmux display-message`.
+func (Tmux) Notify(n Notification) error {
+	if os.Getenv("TMUX") == "" {
+		return fmt.Errorf("not running within tmux")
+	}
+	// tmux expands formats beginning with # in the message
+	message := strings.ReplaceAll(sanitize(n.Title+": "+n.Body), "#", "##")
+	return runDetached(exec.Command("tmux", "display-message", message))
+}
+
+// Command runs a user-specified command for each notification. The
+// placeholders within its arguments are replaced, and the notification is
+// also described in the environment variables WISTERIA_TITLE, WISTERIA_BODY
+// and WISTERIA_URGENCY.
+type Command struct {
+	Args []string
+}
+
+// Notify runs the command without waiting for it to finish.
+func (c Command) Notify(n Notification) error {
+	replacer := strings.NewReplacer(
+		PlaceholderTitle, n.Title,
+		PlaceholderBody, n.Body,
+		PlaceholderUrgency, string(n.Urgency),
+	)
+	args := make([]string, len(c.Args))
+	for i, arg := range c.Args {
+		args[i] = replacer.Replace(arg)
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = append(os.Environ(),
+		"WISTERIA_TITLE="+n.Title,
+		"WISTERIA_BODY="+n.Body,
+		"WISTERIA_URGENCY="+string(n.Urgency),
+	)
+	return runDetached(cmd)
+}
+
+// runDetached starts the command and logs its failure once it exits.
+func runDetached(cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed starting %s: %w", cmd.Path, err)
+	}
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			log.Printf("Notification command %s failed: %v", cmd.Path, err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,138 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withEnv sets the environment variable for the duration of the test.
+func withEnv(t *testing.T, key, value string) {
+	old, had := os.LookupEnv(key)
+	os.Setenv(key, value)
+	t.Cleanup(func() {
+		if had {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+func TestCheckBackends(t *testing.T) {
+	if err := CheckBackends(Backends, Options{Command: []string{"true"}}); err != nil {
+		t.Errorf("expected every backend to be accepted: %v", err)
+	}
+	err := CheckBackends([]string{"pigeon", BackendCommand}, Options{})
+	if err == nil {
+		t.Fatalf("expected an unknown backend and a missing command to be rejected")
+	}
+	for _, problem := range []string{`unknown notifier "pigeon"`, `notifier "command" requires a command`} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Errorf("expected %q to report %q", err, problem)
+		}
+	}
+	if _, err := NewNotifier([]string{"pigeon"}, Options{}); err == nil {
+		t.Errorf("expected NewNotifier to reject an unknown backend")
+	}
+}
+
+func TestTerminalBackends(t *testing.T) {
+	withEnv(t, "TMUX", "")
+	n := Notification{Title: "Mention; in general", Body: "line one\nline\x1b two"}
+	for _, test := range []struct {
+		backend  string
+		expected string
+	}{
+		{BackendBell, "\a"},
+		{BackendOSC9, "\x1b]9;Mention: in general: line one line  two\a"},
+		{BackendOSC777, "\x1b]777;notify;Mention: in general;line one line  two\a"},
+	} {
+		var out bytes.Buffer
+		notifier, err := NewNotifier([]string{test.backend}, Options{Terminal: &out})
+		if err != nil {
+			t.Fatalf("failed creating %s notifier: %v", test.backend, err)
+		}
+		if err := notifier.Notify(n); err != nil {
+			t.Errorf("failed notifying through %s: %v", test.backend, err)
+		}
+		if out.String() != test.expected {
+			t.Errorf("expected %s to write %q, got %q", test.backend, test.expected, out.String())
+		}
+	}
+}
+
+func TestOSCWithinTmux(t *testing.T) {
+	withEnv(t, "TMUX", "/tmp/tmux-1000/default,1,0")
+	var out bytes.Buffer
+	osc := &OSC{Out: &out, Format: OSC9}
+	if err := osc.Notify(Notification{Title: "t", Body: "b"}); err != nil {
+		t.Fatalf("failed notifying: %v", err)
+	}
+	expected := "\x1bPtmux;\x1b\x1b]9;t: b\a\x1b\\"
+	if out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestTmuxOutsideTmux(t *testing.T) {
+	withEnv(t, "TMUX", "")
+	if err := (Tmux{}).Notify(Notification{Title: "t", Body: "b"}); err == nil {
+		t.Errorf("expected the tmux backend to fail outside of tmux")
+	}
+}
+
+// failing is a Notifier that always fails
+type failing struct{}
+
+func (failing) Notify(n Notification) error {
+	return fmt.Errorf("failed on purpose")
+}
+
+func TestMultiNotifiesEveryBackend(t *testing.T) {
+	var out bytes.Buffer
+	multi := Multi{failing{}, &Bell{Out: &out}}
+	if err := multi.Notify(Notification{}); err == nil || !strings.Contains(err.Error(), "failed on purpose") {
+		t.Errorf("expected the failure to be reported, got %v", err)
+	}
+	if out.String() != "\a" {
+		t.Errorf("expected the bell to ring despite the earlier failure")
+	}
+}
+
+func TestCommand(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no shell to run")
+	}
+	dir, err := ioutil.TempDir("", "notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "output")
+	command := Command{Args: []string{sh, "-c",
+		`printf '%s|%s|%s|%s' "$1" "$WISTERIA_TITLE" "$WISTERIA_URGENCY" "$2" > "$3"`,
+		"sh", "{title} ({urgency})", "{body}", output}}
+	if err := command.Notify(Notification{Title: "Reply", Body: "hello there", Urgency: UrgencyLow}); err != nil {
+		t.Fatalf("failed running command: %v", err)
+	}
+	expected := "Reply (low)|Reply|low|hello there"
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		b, err := ioutil.ReadFile(output)
+		if err == nil && string(b) == expected {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the command to write %q, got %q (%v)", expected, b, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
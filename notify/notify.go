@@ -0,0 +1,292 @@
+// Package notify decides which arriving messages deserve a notification
+// according to user-configurable rules.
+package notify
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Urgency is how insistently a notification is presented.
+type Urgency string
+
+// Urgencies from least to most insistent. An unset urgency means UrgencyNormal.
+const (
+	UrgencyLow      Urgency = "low"
+	UrgencyNormal   Urgency = "normal"
+	UrgencyCritical Urgency = "critical"
+)
+
+// rank orders the urgencies, returning -1 for unknown ones.
+func (u Urgency) rank() int {
+	switch u {
+	case UrgencyLow:
+		return 0
+	case UrgencyNormal, "":
+		return 1
+	case UrgencyCritical:
+		return 2
+	}
+	return -1
+}
+
+// Kinds of Rule
+const (
+	// KindMention matches messages that mention the user's name as a whole word
+	KindMention = "mention"
+	// KindReply matches direct replies to the user's messages
+	KindReply = "reply"
+	// KindFollowed matches messages in conversations that the user follows
+	KindFollowed = "followed"
+	// KindKeyword matches messages containing any of the rule's Words as a
+	// whole word, ignoring case
+	KindKeyword = "keyword"
+	// KindRegexp matches messages matching any of the rule's Words as a
+	// regular expression
+	KindRegexp = "regexp"
+)
+
+// kindReasons describe why a message matching each kind of rule is notable
+var kindReasons = map[string]string{
+	KindMention:  "Mention",
+	KindReply:    "Reply",
+	KindFollowed: "Followed conversation",
+	KindKeyword:  "Keyword",
+	KindRegexp:   "Keyword",
+}
+
+// Rule describes messages that trigger a notification.
+type Rule struct {
+	// Kind is one of the Kind constants
+	Kind string
+	// Words are the keywords or regular expressions of KindKeyword and
+	// KindRegexp rules
+	Words []string `json:",omitempty"`
+	// Urgency of the notifications triggered by the rule
+	Urgency Urgency `json:",omitempty"`
+	// Name replaces the default description of the rule's notifications
+	Name string `json:",omitempty"`
+}
+
+// Override changes the rules within one community.
+type Override struct {
+	// Mute suppresses every notification from the community
+	Mute bool `json:",omitempty"`
+	// Rules replace the global rules within the community if set
+	Rules []Rule `json:",omitempty"`
+	// Urgency replaces the urgency of every rule within the community if set
+	Urgency Urgency `json:",omitempty"`
+}
+
+// Settings are the user's configured notification rules.
+type Settings struct {
+	// Rules apply in every community. If nil, DefaultRules are used.
+	Rules []Rule `json:",omitempty"`
+	// Communities maps community names or IDs to changes in the rules within
+	// those communities
+	Communities map[string]Override `json:",omitempty"`
+	// QuietHours are periods of the day, written like "22:00-07:00", during
+	// which notifications are suppressed and only kept in the history
+	QuietHours []string `json:",omitempty"`
+	// Interval is the shortest time between notifications, written like
+	// "30s". Messages matching in between are combined into one notification.
+	// If empty, DefaultInterval is used.
+	Interval string `json:",omitempty"`
+}
+
+// DefaultRules notify about mentions of the user and replies to them.
+func DefaultRules() []Rule {
+	return []Rule{
+		{Kind: KindMention, Urgency: UrgencyNormal},
+		{Kind: KindReply, Urgency: UrgencyNormal},
+	}
+}
+
+// Message describes an arriving message in the terms that rules match on.
+type Message struct {
+	Content string
+	// Community and CommunityName identify the community of the message
+	Community, CommunityName string
+	// FromSelf indicates that the user wrote the message
+	FromSelf bool
+	// ReplyToSelf indicates that the message replies directly to one of the
+	// user's messages
+	ReplyToSelf bool
+	// Followed indicates that the message is in a conversation that the user
+	// follows
+	Followed bool
+}
+
+// Match describes why a message deserves a notification.
+type Match struct {
+	Rule    Rule
+	Urgency Urgency
+	// Reason summarizes why the message matched, like "Mention"
+	Reason string
+}
+
+// compiledRule is a Rule prepared for matching.
+type compiledRule struct {
+	Rule
+	patterns []*regexp.Regexp
+}
+
+// Engine matches messages against compiled notification rules.
+type Engine struct {
+	rules       []compiledRule
+	communities map[string]compiledOverride
+	mention     *regexp.Regexp
+}
+
+// compiledOverride is an Override prepared for matching.
+type compiledOverride struct {
+	Override
+	rules []compiledRule
+}
+
+// wordPattern returns a case-insensitive regular expression matching the
+// word only where it is not part of a longer word.
+func wordPattern(word string) string {
+	return `(?i)(^|[^\pL\pN_])` + regexp.QuoteMeta(word) + `($|[^\pL\pN_])`
+}
+
+// New compiles the settings for a user with the given name. It errors if any
+// rule has an unknown kind or urgency or an invalid regular expression.
+func New(settings Settings, username string) (*Engine, error) {
+	e := &Engine{communities: make(map[string]compiledOverride)}
+	problems := []string{}
+	rules := settings.Rules
+	if rules == nil {
+		rules = DefaultRules()
+	}
+	e.rules = compileRules(rules, "", &problems)
+	names := make([]string, 0, len(settings.Communities))
+	for name := range settings.Communities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		override := settings.Communities[name]
+		if override.Urgency.rank() < 0 {
+			problems = append(problems, fmt.Sprintf("community %q: unknown urgency %q", name, override.Urgency))
+		}
+		e.communities[name] = compiledOverride{
+			Override: override,
+			rules:    compileRules(override.Rules, fmt.Sprintf("community %q ", name), &problems),
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	if username = strings.TrimSpace(username); username != "" {
+		e.mention = regexp.MustCompile(wordPattern(username))
+	}
+	return e, nil
+}
+
+// compileRules prepares the rules for matching, describing any problems with
+// them in problems.
+func compileRules(rules []Rule, context string, problems *[]string) []compiledRule {
+	compiled := make([]compiledRule, 0, len(rules))
+	for i, rule := range rules {
+		where := fmt.Sprintf("%srule %d", context, i+1)
+		if _, ok := kindReasons[rule.Kind]; !ok {
+			*problems = append(*problems, fmt.Sprintf("%s: unknown kind %q", where, rule.Kind))
+			continue
+		}
+		if rule.Urgency.rank() < 0 {
+			*problems = append(*problems, fmt.Sprintf("%s: unknown urgency %q", where, rule.Urgency))
+		}
+		c := compiledRule{Rule: rule}
+		switch rule.Kind {
+		case KindKeyword:
+			for _, word := range rule.Words {
+				c.patterns = append(c.patterns, regexp.MustCompile(wordPattern(word)))
+			}
+		case KindRegexp:
+			for _, word := range rule.Words {
+				pattern, err := regexp.Compile(word)
+				if err != nil {
+					*problems = append(*problems, fmt.Sprintf("%s: %v", where, err))
+					continue
+				}
+				c.patterns = append(c.patterns, pattern)
+			}
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled
+}
+
+// Check reports whether the settings are valid. See New and NewDispatcher.
+func Check(settings Settings) error {
+	if _, err := New(settings, ""); err != nil {
+		return err
+	}
+	_, err := NewDispatcher(settings, nil)
+	return err
+}
+
+// Match returns the most urgent rule matching the message, if any. Messages
+// written by the user never match.
+func (e *Engine) Match(message Message) (Match, bool) {
+	if message.FromSelf {
+		return Match{}, false
+	}
+	rules := e.rules
+	override, overridden := e.communities[message.Community]
+	if !overridden {
+		override, overridden = e.communities[message.CommunityName]
+	}
+	if overridden {
+		if override.Mute {
+			return Match{}, false
+		}
+		if override.Rules != nil {
+			rules = override.rules
+		}
+	}
+	best, found := Match{}, false
+	for _, rule := range rules {
+		if !e.matches(rule, message) {
+			continue
+		}
+		urgency := rule.Urgency
+		if overridden && override.Urgency != "" {
+			urgency = override.Urgency
+		}
+		if urgency == "" {
+			urgency = UrgencyNormal
+		}
+		if found && urgency.rank() <= best.Urgency.rank() {
+			continue
+		}
+		reason := rule.Name
+		if reason == "" {
+			reason = kindReasons[rule.Kind]
+		}
+		best, found = Match{Rule: rule.Rule, Urgency: urgency, Reason: reason}, true
+	}
+	return best, found
+}
+
+// matches reports whether a single rule matches the message.
+func (e *Engine) matches(rule compiledRule, message Message) bool {
+	switch rule.Kind {
+	case KindMention:
+		return e.mention != nil && e.mention.MatchString(message.Content)
+	case KindReply:
+		return message.ReplyToSelf
+	case KindFollowed:
+		return message.Followed
+	case KindKeyword, KindRegexp:
+		for _, pattern := range rule.patterns {
+			if pattern.MatchString(message.Content) {
+				return true
+			}
+		}
+	}
+	return false
+}
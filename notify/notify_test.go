@@ -0,0 +1,108 @@
+package notify
+
+import (
+	"strings"
+	"testing"
+)
+
+func mustNew(t *testing.T, settings Settings, username string) *Engine {
+	t.Helper()
+	engine, err := New(settings, username)
+	if err != nil {
+		t.Fatalf("failed compiling settings: %v", err)
+	}
+	return engine
+}
+
+func TestDefaultRules(t *testing.T) {
+	engine := mustNew(t, Settings{}, "alice")
+	for _, test := range []struct {
+		message Message
+		reason  string
+	}{
+		{Message{Content: "hey Alice, look"}, "Mention"},
+		{Message{Content: "ALICE"}, "Mention"},
+		{Message{Content: "@alice: hi"}, "Mention"},
+		{Message{Content: "malice aforethought"}, ""},
+		{Message{Content: "alice_smith"}, ""},
+		{Message{Content: "unrelated", ReplyToSelf: true}, "Reply"},
+		{Message{Content: "unrelated", Followed: true}, ""},
+		{Message{Content: "alice", FromSelf: true}, ""},
+	} {
+		match, notable := engine.Match(test.message)
+		if notable != (test.reason != "") || match.Reason != test.reason {
+			t.Errorf("expected %+v to match with reason %q, got %v %q", test.message, test.reason, notable, match.Reason)
+		}
+		if notable && match.Urgency != UrgencyNormal {
+			t.Errorf("expected %+v to match with normal urgency, got %q", test.message, match.Urgency)
+		}
+	}
+}
+
+func TestMostUrgentRuleWins(t *testing.T) {
+	engine := mustNew(t, Settings{Rules: []Rule{
+		{Kind: KindKeyword, Words: []string{"deploy"}, Urgency: UrgencyLow},
+		{Kind: KindRegexp, Words: []string{`outage|down\b`}, Urgency: UrgencyCritical, Name: "Incident"},
+		{Kind: KindFollowed},
+	}}, "")
+	for _, test := range []struct {
+		message Message
+		urgency Urgency
+		reason  string
+	}{
+		{Message{Content: "Deploy finished"}, UrgencyLow, "Keyword"},
+		{Message{Content: "redeploy"}, "", ""},
+		{Message{Content: "deploy caused an outage"}, UrgencyCritical, "Incident"},
+		{Message{Content: "deploy done", Followed: true}, UrgencyNormal, "Followed conversation"},
+		{Message{Content: "mentions nobody"}, "", ""},
+	} {
+		match, notable := engine.Match(test.message)
+		if notable != (test.reason != "") || match.Urgency != test.urgency || match.Reason != test.reason {
+			t.Errorf("expected %+v to match as %q %q, got %v %q %q", test.message, test.urgency, test.reason, notable, match.Urgency, match.Reason)
+		}
+	}
+}
+
+func TestCommunityOverrides(t *testing.T) {
+	engine := mustNew(t, Settings{
+		Communities: map[string]Override{
+			"muted":      {Mute: true},
+			"loud-id":    {Urgency: UrgencyCritical},
+			"everything": {Rules: []Rule{{Kind: KindRegexp, Words: []string{"."}, Urgency: UrgencyLow}}},
+		},
+	}, "bob")
+	for _, test := range []struct {
+		message Message
+		urgency Urgency
+	}{
+		{Message{Content: "bob", CommunityName: "muted"}, ""},
+		{Message{Content: "bob", Community: "muted"}, ""},
+		{Message{Content: "bob", Community: "loud-id", CommunityName: "loud"}, UrgencyCritical},
+		{Message{Content: "anything", CommunityName: "everything"}, UrgencyLow},
+		{Message{Content: "bob", CommunityName: "elsewhere"}, UrgencyNormal},
+	} {
+		match, notable := engine.Match(test.message)
+		if notable != (test.urgency != "") || match.Urgency != test.urgency {
+			t.Errorf("expected %+v to match with urgency %q, got %v %q", test.message, test.urgency, notable, match.Urgency)
+		}
+	}
+}
+
+func TestInvalidSettings(t *testing.T) {
+	_, err := New(Settings{
+		Rules: []Rule{
+			{Kind: "whisper"},
+			{Kind: KindKeyword, Urgency: "deafening"},
+			{Kind: KindRegexp, Words: []string{"("}},
+		},
+		Communities: map[string]Override{"c": {Urgency: "eventually"}},
+	}, "")
+	if err == nil {
+		t.Fatalf("expected invalid settings to be rejected")
+	}
+	for _, problem := range []string{`rule 1: unknown kind "whisper"`, `rule 2: unknown urgency "deafening"`, "rule 3: error parsing regexp", `community "c": unknown urgency "eventually"`} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Errorf("expected %q to report %q", err, problem)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"git.sr.ht/~whereswaldon/wisteria/atomicfile"
+)
+
+// Pins holds the certificate fingerprint of each relay whose certificate is
+// trusted on first use. They are saved whenever one changes.
+type Pins struct {
+	sync.Mutex
+	// Fingerprints maps relay addresses to the fingerprints of their
+	// certificates
+	Fingerprints map[string]string
+
+	path string
+}
+
+// LoadPins loads the Pins saved at the given path. If nothing has been saved
+// there yet, no relays are pinned.
+func LoadPins(path string) (*Pins, error) {
+	p := &Pins{path: path, Fingerprints: make(map[string]string)}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return p, nil
+		}
+		return nil, fmt.Errorf("failed reading relay pins: %w", err)
+	}
+	if err := json.Unmarshal(b, &p.Fingerprints); err != nil {
+		return nil, fmt.Errorf("failed parsing relay pins in %s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Get returns the fingerprint pinned for the relay at the address, if any.
+func (p *Pins) Get(address string) (string, bool) {
+	p.Lock()
+	defer p.Unlock()
+	fingerprint, ok := p.Fingerprints[address]
+	return fingerprint, ok
+}
+
+// Set pins the fingerprint for the relay at the address and saves the pins.
+func (p *Pins) Set(address, fingerprint string) error {
+	p.Lock()
+	defer p.Unlock()
+	p.Fingerprints[address] = fingerprint
+	b, err := json.MarshalIndent(p.Fingerprints, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed encoding relay pins: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(p.path), 0770); err != nil {
+		return fmt.Errorf("failed creating relay pins directory: %w", err)
+	}
+	if err := atomicfile.WriteFile(p.path, b, 0660); err != nil {
+		return fmt.Errorf("failed saving relay pins: %w", err)
+	}
+	return nil
+}
+
+// Fingerprint identifies a DER-encoded certificate, like "SHA256:ab01...".
+func Fingerprint(certificate []byte) string {
+	sum := sha256.Sum256(certificate)
+	return "SHA256:" + hex.EncodeToString(sum[:])
+}
+
+// FingerprintMismatchError reports that a relay presented a certificate other
+// than the one pinned for it.
+type FingerprintMismatchError struct {
+	Address           string
+	Pinned, Presented string
+}
+
+func (e *FingerprintMismatchError) Error() string {
+	return fmt.Sprintf("certificate of %s changed from %s to %s", e.Address, e.Pinned, e.Presented)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// selfSigned creates a certificate for localhost signed by its own key.
+func selfSigned(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed generating key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed creating certificate: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// serveTLS accepts TLS connections presenting the certificate until the test
+// ends, closing each once its handshake completes.
+func serveTLS(t *testing.T, certificate tls.Certificate) string {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{certificate}})
+	if err != nil {
+		t.Fatalf("failed listening: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestPinsSaveAndLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wisteria-pins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "nested", "pins.json")
+	pins, err := LoadPins(path)
+	if err != nil {
+		t.Fatalf("failed loading missing pins: %v", err)
+	}
+	if err := pins.Set("relay:7117", "SHA256:00"); err != nil {
+		t.Fatalf("failed setting pin: %v", err)
+	}
+	loaded, err := LoadPins(path)
+	if err != nil {
+		t.Fatalf("failed loading pins: %v", err)
+	}
+	if fingerprint, ok := loaded.Get("relay:7117"); !ok || fingerprint != "SHA256:00" {
+		t.Errorf("expected the pin to be saved, got %q", fingerprint)
+	}
+}
+
+func TestTrustOnFirstUse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wisteria-pins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pins, err := LoadPins(filepath.Join(dir, "pins.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager := &RelayManager{Pins: pins}
+	certificate := selfSigned(t)
+	relay := Relay{Address: serveTLS(t, certificate), TLS: RelayTLSTrustOnFirstUse}
+
+	conn, err := manager.dial(relay)
+	if err != nil {
+		t.Fatalf("failed connecting on first use: %v", err)
+	}
+	conn.Close()
+	fingerprint, ok := pins.Get(relay.Address)
+	if !ok || fingerprint != Fingerprint(certificate.Certificate[0]) {
+		t.Fatalf("expected the certificate to be pinned, got %q", fingerprint)
+	}
+	if conn, err = manager.dial(relay); err != nil {
+		t.Fatalf("failed connecting with the pinned certificate: %v", err)
+	}
+	conn.Close()
+
+	// a relay presenting another certificate at the same address is refused
+	other := Relay{Address: serveTLS(t, selfSigned(t)), TLS: RelayTLSTrustOnFirstUse}
+	if err := pins.Set(other.Address, fingerprint); err != nil {
+		t.Fatal(err)
+	}
+	_, err = manager.dial(other)
+	mismatch := &FingerprintMismatchError{}
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("expected a fingerprint mismatch, got %v", err)
+	}
+	if mismatch.Pinned != fingerprint {
+		t.Errorf("expected mismatch with %s, got %s", fingerprint, mismatch.Pinned)
+	}
+}
+
+func TestNoPinWithoutHandshake(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wisteria-pins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pins, err := LoadPins(filepath.Join(dir, "pins.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	relay := Relay{Address: "relay:7117", TLS: RelayTLSTrustOnFirstUse}
+	config, err := relay.TLSConfig(pins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.VerifyPeerCertificate(selfSigned(t).Certificate, nil); err != nil {
+		t.Fatalf("expected an unpinned certificate to be accepted: %v", err)
+	}
+	if _, ok := pins.Get(relay.Address); ok {
+		t.Errorf("certificate pinned before the handshake completed")
+	}
+}
@@ -0,0 +1,507 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	forest "git.sr.ht/~whereswaldon/forest-go"
+	"git.sr.ht/~whereswaldon/forest-go/store"
+	"git.sr.ht/~whereswaldon/sprout-go"
+	"git.sr.ht/~whereswaldon/wisteria/atomicfile"
+	"git.sr.ht/~whereswaldon/wisteria/socks"
+)
+
+const (
+	// relayDialTimeout limits how long connecting to a relay may take
+	relayDialTimeout = 30 * time.Second
+	// relayMinBackoff and relayMaxBackoff bound the wait between attempts to
+	// connect to a relay, which doubles with each failed attempt
+	relayMinBackoff = time.Second
+	relayMaxBackoff = time.Minute
+	// relayBootstrapCommunities is the number of communities whose history is
+	// requested from a relay upon connecting
+	relayBootstrapCommunities = 1024
+	// relayChangeInterval is the shortest time between reports of nodes
+	// arriving from relays
+	relayChangeInterval = time.Second
+)
+
+// States of a relay connection
+const (
+	// RelayDisconnected relays have no worker
+	RelayDisconnected = "disconnected"
+	// RelayConnecting relays are being connected to for the first time
+	RelayConnecting = "connecting"
+	// RelayConnected relays are exchanging nodes
+	RelayConnected = "connected"
+	// RelayReconnecting relays lost their connection and are being connected
+	// to again
+	RelayReconnecting = "reconnecting"
+	// RelayFailed relays could not be connected to at the last attempt. They
+	// are retried after a delay.
+	RelayFailed = "failed"
+	// RelayUntrusted relays presented a certificate other than the one pinned
+	// for them. They aren't retried until the new certificate is trusted.
+	RelayUntrusted = "untrusted"
+)
+
+// RelayStatus describes the connection to a relay.
+type RelayStatus struct {
+	// State is one of the Relay state constants
+	State string
+	// Since is when the relay entered its State
+	Since time.Time
+	// LastError is the most recent failure to connect, if any
+	LastError error
+	// LastErrorTime is when LastError happened
+	LastErrorTime time.Time
+	// LastNode is when the most recent node arrived from the relay
+	LastNode time.Time
+	// Nodes counts the nodes that arrived from the relay
+	Nodes int
+}
+
+// managedRelay is a relay known to a RelayManager along with the channel that
+// stops its worker, which is nil while it is disconnected.
+type managedRelay struct {
+	Relay
+	RelayStatus
+	done chan struct{}
+	// retry wakes a worker waiting for the relay's certificate to be trusted
+	retry chan struct{}
+}
+
+// RelayState describes a relay known to a RelayManager.
+type RelayState struct {
+	Relay
+	RelayStatus
+}
+
+// Active reports whether a worker is exchanging nodes with the relay or
+// trying to connect to it.
+func (r RelayState) Active() bool {
+	return r.State != RelayDisconnected
+}
+
+// RelayManager connects to and disconnects from relays while wisteria runs. It
+// knows every configured relay, including those that aren't connected, and
+// those connected to since startup.
+type RelayManager struct {
+	// Store is the store that the relays exchange nodes with
+	Store store.ExtendedStore
+	// ConfigPath is the configuration file updated by Save
+	ConfigPath string
+	// OnChange is called from the workers' goroutines whenever the status of
+	// a relay changes, if it is set. It must be set before connecting.
+	OnChange func()
+	// Pins hold the certificates of the relays trusted on first use
+	Pins *Pins
+	// Proxy is the SOCKS5 proxy that relays are dialed through unless they
+	// choose their own. If empty, they are dialed directly.
+	Proxy string
+	// OnUntrusted is called from a worker's goroutine when its relay presents
+	// a certificate other than the pinned one, if it is set. The relay is
+	// retried once TrustCertificate accepts the new certificate. It must be
+	// set before connecting.
+	OnUntrusted func(mismatch *FingerprintMismatchError)
+
+	sync.Mutex
+	relays      []*managedRelay
+	lastChanged time.Time
+}
+
+// NewRelayManager creates a RelayManager that knows the configured relays
+// without connecting to any of them.
+func NewRelayManager(s store.ExtendedStore, configPath string, pins *Pins, configured []Relay) *RelayManager {
+	m := &RelayManager{
+		Store:      s,
+		ConfigPath: configPath,
+		Pins:       pins,
+	}
+	for _, relay := range configured {
+		m.relays = append(m.relays, &managedRelay{
+			Relay:       relay,
+			RelayStatus: RelayStatus{State: RelayDisconnected, Since: time.Now()},
+		})
+	}
+	return m
+}
+
+// find returns the relay with the given address, if it is known. The caller
+// must hold the lock.
+func (m *RelayManager) find(address string) (*managedRelay, bool) {
+	for _, relay := range m.relays {
+		if relay.Address == address {
+			return relay, true
+		}
+	}
+	return nil, false
+}
+
+// Connect launches a worker exchanging nodes with the relay, which reconnects
+// whenever the connection is lost. A relay that is already known keeps its
+// settings.
+func (m *RelayManager) Connect(relay Relay) error {
+	if err := relay.Validate(); err != nil {
+		return err
+	}
+	m.Lock()
+	managed, known := m.find(relay.Address)
+	if !known {
+		managed = &managedRelay{Relay: relay}
+		m.relays = append(m.relays, managed)
+	}
+	if managed.done != nil {
+		m.Unlock()
+		return fmt.Errorf("already connected to %s", relay.Address)
+	}
+	done := make(chan struct{})
+	managed.done = done
+	managed.retry = make(chan struct{}, 1)
+	managed.State, managed.Since = RelayConnecting, time.Now()
+	m.Unlock()
+	m.changed(true)
+	go m.supervise(managed, done)
+	return nil
+}
+
+// Disconnect stops the worker exchanging nodes with the relay at the address.
+func (m *RelayManager) Disconnect(address string) error {
+	m.Lock()
+	managed, known := m.find(address)
+	if !known || managed.done == nil {
+		m.Unlock()
+		return fmt.Errorf("not connected to %s", address)
+	}
+	close(managed.done)
+	managed.done = nil
+	managed.State, managed.Since = RelayDisconnected, time.Now()
+	m.Unlock()
+	m.changed(true)
+	return nil
+}
+
+// TrustCertificate pins the certificate presented by the relay in place of
+// the one pinned before, and retries the relay if it is waiting for that.
+func (m *RelayManager) TrustCertificate(mismatch *FingerprintMismatchError) error {
+	if err := m.Pins.Set(mismatch.Address, mismatch.Presented); err != nil {
+		return err
+	}
+	m.Lock()
+	defer m.Unlock()
+	if managed, known := m.find(mismatch.Address); known && managed.done != nil {
+		select {
+		case managed.retry <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Close disconnects from every relay.
+func (m *RelayManager) Close() {
+	m.Lock()
+	defer m.Unlock()
+	for _, managed := range m.relays {
+		if managed.done != nil {
+			close(managed.done)
+			managed.done = nil
+			managed.State, managed.Since = RelayDisconnected, time.Now()
+		}
+	}
+}
+
+// Relays describes every known relay in the order that they became known.
+func (m *RelayManager) Relays() []RelayState {
+	m.Lock()
+	defer m.Unlock()
+	states := make([]RelayState, len(m.relays))
+	for i, managed := range m.relays {
+		states[i] = RelayState{Relay: managed.Relay, RelayStatus: managed.RelayStatus}
+	}
+	return states
+}
+
+// changed calls OnChange. Unless important is set, it is called at most once
+// per relayChangeInterval.
+func (m *RelayManager) changed(important bool) {
+	if m.OnChange == nil {
+		return
+	}
+	m.Lock()
+	now := time.Now()
+	skip := !important && now.Sub(m.lastChanged) < relayChangeInterval
+	if !skip {
+		m.lastChanged = now
+	}
+	m.Unlock()
+	if !skip {
+		m.OnChange()
+	}
+}
+
+// update changes the status of the relay with the given function unless the
+// worker that stops when done has been replaced or disconnected.
+func (m *RelayManager) update(managed *managedRelay, done chan struct{}, important bool, change func(status *RelayStatus)) {
+	m.Lock()
+	current := managed.done == done
+	if current {
+		change(&managed.RelayStatus)
+	}
+	m.Unlock()
+	if current {
+		m.changed(important)
+	}
+}
+
+// setState moves the relay into the state, recording err if it is set.
+func (m *RelayManager) setState(managed *managedRelay, done chan struct{}, state string, err error) {
+	m.update(managed, done, true, func(status *RelayStatus) {
+		status.State, status.Since = state, time.Now()
+		if err != nil {
+			status.LastError, status.LastErrorTime = err, status.Since
+		}
+	})
+}
+
+// supervise connects to the relay until done is closed, waiting longer after
+// each failed attempt.
+func (m *RelayManager) supervise(managed *managedRelay, done chan struct{}) {
+	logger := log.New(log.Writer(), managed.Name()+" ", log.Flags())
+	m.Lock()
+	retry := managed.retry
+	m.Unlock()
+	backoff := relayMinBackoff
+	for {
+		err := m.exchange(managed, done, logger)
+		select {
+		case <-done:
+			return
+		default:
+		}
+		mismatch := &FingerprintMismatchError{}
+		if errors.As(err, &mismatch) {
+			logger.Printf("WARNING: %v; refusing to connect until the new certificate is trusted", err)
+			m.setState(managed, done, RelayUntrusted, err)
+			if m.OnUntrusted != nil {
+				m.OnUntrusted(mismatch)
+			}
+			select {
+			case <-done:
+				return
+			case <-retry:
+			}
+			backoff = relayMinBackoff
+			continue
+		}
+		if err != nil {
+			logger.Printf("Failed connecting, retrying in %v: %v", backoff, err)
+			m.setState(managed, done, RelayFailed, err)
+		} else {
+			logger.Printf("Lost connection, reconnecting")
+			m.setState(managed, done, RelayReconnecting, nil)
+			backoff = relayMinBackoff
+		}
+		select {
+		case <-done:
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > relayMaxBackoff {
+			backoff = relayMaxBackoff
+		}
+	}
+}
+
+// exchange connects to the relay and exchanges nodes with it until the
+// connection is lost or done is closed. It errors only if the connection
+// could not be established.
+func (m *RelayManager) exchange(managed *managedRelay, done chan struct{}, logger *log.Logger) error {
+	conn, err := m.dial(managed.Relay)
+	if err != nil {
+		return err
+	}
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		// the worker stops once its connection closes
+		select {
+		case <-done:
+		case <-finished:
+		}
+		conn.Close()
+	}()
+	s := &relayStore{
+		ExtendedStore: m.Store,
+		onNode: func() {
+			m.update(managed, done, false, func(status *RelayStatus) {
+				status.LastNode = time.Now()
+				status.Nodes++
+			})
+		},
+	}
+	worker, err := sprout.NewWorker(done, conn, s)
+	if err != nil {
+		return fmt.Errorf("failed starting worker: %w", err)
+	}
+	worker.Logger = logger
+	logger.Printf("Connected")
+	m.setState(managed, done, RelayConnected, nil)
+	go worker.BootstrapLocalStore(relayBootstrapCommunities)
+	worker.Run()
+	return nil
+}
+
+// dial establishes a TLS connection to the relay, through a proxy if one
+// applies to it.
+func (m *RelayManager) dial(relay Relay) (net.Conn, error) {
+	tlsConfig, err := relay.TLSConfig(m.Pins)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: relayDialTimeout}
+	var conn net.Conn
+	if proxy := relay.ProxyFor(m.Proxy); proxy != "" {
+		socksDialer, err := socks.FromURL(proxy)
+		if err != nil {
+			return nil, err
+		}
+		socksDialer.Forward = dialer
+		conn, err = socksDialer.Dial("tcp", relay.Address)
+		if err != nil {
+			return nil, err
+		}
+	} else if conn, err = dialer.Dial("tcp", relay.Address); err != nil {
+		return nil, err
+	}
+	if tlsConfig.ServerName == "" {
+		host, _, _ := net.SplitHostPort(relay.Address)
+		tlsConfig.ServerName = host
+	}
+	tlsConn := tls.Client(conn, tlsConfig)
+	conn.SetDeadline(time.Now().Add(relayDialTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := relay.pinCertificate(m.Pins, tlsConn.ConnectionState()); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return tlsConn, nil
+}
+
+// relayStore counts the nodes that a relay's worker adds to the store.
+type relayStore struct {
+	store.ExtendedStore
+	onNode func()
+}
+
+// Add reports the node and adds it to the store.
+func (s *relayStore) Add(node forest.Node) error {
+	s.onNode()
+	return s.ExtendedStore.Add(node)
+}
+
+// AddAs reports the node and adds it to the store on behalf of the
+// subscription, if the store supports that.
+func (s *relayStore) AddAs(node forest.Node, addedBy store.Subscription) error {
+	s.onNode()
+	if adder, ok := s.ExtendedStore.(interface {
+		AddAs(forest.Node, store.Subscription) error
+	}); ok {
+		return adder.AddAs(node, addedBy)
+	}
+	return s.ExtendedStore.Add(node)
+}
+
+// Save replaces the relays in the configuration file with the known relays,
+// enabling exactly those that are connected or trying to connect. The rest of
+// the file is left untouched.
+func (m *RelayManager) Save() error {
+	states := m.Relays()
+	relays := make([]Relay, len(states))
+	for i, state := range states {
+		relays[i] = state.Relay
+		relays[i].Enabled = TristateUndefined
+		if !state.Active() {
+			relays[i].Enabled = TristateFalse
+		}
+	}
+	return SaveRelays(m.ConfigPath, relays)
+}
+
+// SaveRelays replaces the Relays within the configuration file at the path.
+// The other settings in the file keep their order and formatting.
+func SaveRelays(configPath string, relays []Relay) error {
+	info, err := os.Stat(configPath)
+	if err != nil {
+		return fmt.Errorf("failed reading config file: %w", err)
+	}
+	b, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed reading config file: %w", err)
+	}
+	encoded, err := json.Marshal(relays)
+	if err != nil {
+		return fmt.Errorf("failed encoding relays: %w", err)
+	}
+	if b, err = replaceField(b, "Relays", encoded); err != nil {
+		return fmt.Errorf("failed parsing config file %s: %w", configPath, err)
+	}
+	if err := atomicfile.WriteFile(configPath, b, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed writing config file: %w", err)
+	}
+	return nil
+}
+
+// replaceField returns the JSON object in doc with the value of the named
+// field replaced by value, or with the field added at the end if it is
+// missing. The rest of the document is copied unchanged.
+func replaceField(doc []byte, name string, value []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(doc))
+	if token, err := decoder.Token(); err != nil {
+		return nil, err
+	} else if token != json.Delim('{') {
+		return nil, fmt.Errorf("expected a JSON object")
+	}
+	// end is the offset just past the last value in the object
+	end := int(decoder.InputOffset())
+	fields := 0
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		var current json.RawMessage
+		if err := decoder.Decode(&current); err != nil {
+			return nil, err
+		}
+		end = int(decoder.InputOffset())
+		fields++
+		if key == name {
+			start := end - len(current)
+			replaced := append(append(append([]byte{}, doc[:start]...), value...), doc[end:]...)
+			return replaced, nil
+		}
+	}
+	field, err := json.Marshal(name)
+	if err != nil {
+		return nil, err
+	}
+	field = append(append(field, ':'), value...)
+	if fields > 0 {
+		field = append([]byte{','}, field...)
+	}
+	return append(append(append([]byte{}, doc[:end]...), field...), doc[end:]...), nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSaveRelays(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wisteria")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	relays := []Relay{
+		{Address: "arbor.example:7117", Label: "home"},
+		{Address: "onion.example:7117", Proxy: "socks5://127.0.0.1:9050", Enabled: TristateFalse},
+	}
+	encoded, err := json.Marshal(relays)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name, before, after string
+	}{
+		{
+			name: "replaces the relays",
+			before: `{
+    "UseGPG": "true",
+    "Relays": [ {"Address": "old.example:7117"} ],
+    "Editor": "vi",
+    "Custom": {"kept": [1, 2]}
+}
+`,
+			after: `{
+    "UseGPG": "true",
+    "Relays": ` + string(encoded) + `,
+    "Editor": "vi",
+    "Custom": {"kept": [1, 2]}
+}
+`,
+		},
+		{
+			name:   "adds missing relays",
+			before: `{"Editor":"vi","PGPUser":"me"}` + "\n",
+			after:  `{"Editor":"vi","PGPUser":"me","Relays":` + string(encoded) + "}\n",
+		},
+		{
+			name:   "adds relays to an empty object",
+			before: "{ }",
+			after:  `{"Relays":` + string(encoded) + " }",
+		},
+	} {
+		path := filepath.Join(dir, "config.json")
+		if err := ioutil.WriteFile(path, []byte(test.before), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := SaveRelays(path, relays); err != nil {
+			t.Fatalf("%s: failed saving relays: %v", test.name, err)
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != test.after {
+			t.Errorf("%s: expected\n%s\ngot\n%s", test.name, test.after, string(b))
+		}
+		var config Config
+		if err := json.Unmarshal(b, &config); err != nil {
+			t.Fatalf("%s: saved config is invalid: %v", test.name, err)
+		}
+		if !reflect.DeepEqual(config.Relays, relays) {
+			t.Errorf("%s: expected relays %+v, got %+v", test.name, relays, config.Relays)
+		}
+		if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+			t.Errorf("%s: expected the permissions of the config file to be kept", test.name)
+		}
+	}
+
+	path := filepath.Join(dir, "broken.json")
+	if err := ioutil.WriteFile(path, []byte(`["not", "an object"]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveRelays(path, relays); err == nil || !strings.Contains(err.Error(), "expected a JSON object") {
+		t.Errorf("expected a config file that isn't an object to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+
+	"git.sr.ht/~whereswaldon/wisteria/socks"
+)
+
+// TLS policies of a Relay
+const (
+	// RelayTLSVerify validates the relay's certificate against the system's
+	// certificate authorities
+	RelayTLSVerify = "verify"
+	// RelayTLSInsecure accepts any certificate from the relay
+	RelayTLSInsecure = "insecure"
+	// RelayTLSTrustOnFirstUse accepts the first certificate presented by the
+	// relay and pins its fingerprint, refusing any other certificate until
+	// the user chooses to trust it
+	RelayTLSTrustOnFirstUse = "tofu"
+)
+
+// RelayProxyDirect dials a relay without the proxy in the configuration
+const RelayProxyDirect = "direct"
+
+// Relay describes a sprout relay that wisteria exchanges nodes with.
+type Relay struct {
+	// Address is the IP:PORT or FQDN:PORT of the relay
+	Address string
+	// Label names the relay in place of its address
+	Label string `json:",omitempty"`
+	// TLS is the policy for checking the relay's certificate, one of the
+	// RelayTLS constants. If empty, RelayTLSVerify is used.
+	TLS string `json:",omitempty"`
+	// CAFile is a PEM bundle of the certificate authorities that the
+	// RelayTLSVerify policy trusts in place of the system's
+	CAFile string `json:",omitempty"`
+	// CertFile and KeyFile are the PEM certificate and key that identify
+	// wisteria to the relay, if it requires client certificates
+	CertFile string `json:",omitempty"`
+	KeyFile  string `json:",omitempty"`
+	// Proxy is the SOCKS5 proxy that the relay is dialed through in place of
+	// the one in the configuration, or RelayProxyDirect to dial it directly
+	Proxy string `json:",omitempty"`
+	// Enabled controls whether wisteria connects to the relay at startup.
+	// Legal values are "true", "false", and "" (empty string enables it)
+	Enabled Tristate `json:",omitempty"`
+}
+
+// Name returns the label of the relay, or its address if it has none.
+func (r Relay) Name() string {
+	if r.Label != "" {
+		return r.Label
+	}
+	return r.Address
+}
+
+// IsEnabled reports whether wisteria should connect to the relay at startup.
+func (r Relay) IsEnabled() bool {
+	return r.Enabled != TristateFalse
+}
+
+// Validate errors if the relay's settings are invalid.
+func (r Relay) Validate() error {
+	if _, _, err := net.SplitHostPort(r.Address); err != nil {
+		return fmt.Errorf("relay address %q should look like HOST:PORT: %w", r.Address, err)
+	}
+	switch r.TLS {
+	case "", RelayTLSVerify:
+	case RelayTLSInsecure, RelayTLSTrustOnFirstUse:
+		if r.CAFile != "" {
+			return fmt.Errorf("relay %s has a CAFile, which only applies to the %q TLS policy", r.Address, RelayTLSVerify)
+		}
+	default:
+		return fmt.Errorf("relay %s has unknown TLS policy %q", r.Address, r.TLS)
+	}
+	if r.Proxy != "" && r.Proxy != RelayProxyDirect {
+		if _, err := socks.FromURL(r.Proxy); err != nil {
+			return fmt.Errorf("relay %s has an invalid proxy: %w", r.Address, err)
+		}
+	}
+	if (r.CertFile == "") != (r.KeyFile == "") {
+		return fmt.Errorf("relay %s needs both a CertFile and a KeyFile to use a client certificate", r.Address)
+	}
+	switch r.Enabled {
+	case TristateTrue, TristateFalse, TristateUndefined:
+	default:
+		return fmt.Errorf("relay %s has illegal Enabled value %q", r.Address, r.Enabled)
+	}
+	return nil
+}
+
+// ProxyFor returns the proxy that the relay is dialed through when the
+// configuration chooses the given proxy, or the empty string if it is dialed
+// directly.
+func (r Relay) ProxyFor(proxy string) string {
+	switch r.Proxy {
+	case "":
+		return proxy
+	case RelayProxyDirect:
+		return ""
+	}
+	return r.Proxy
+}
+
+// TLSConfig returns the TLS configuration for connecting to the relay. The
+// certificates of relays with the RelayTLSTrustOnFirstUse policy are checked
+// against the pins.
+func (r Relay) TLSConfig(pins *Pins) (*tls.Config, error) {
+	config := &tls.Config{}
+	switch r.TLS {
+	case RelayTLSInsecure:
+		config.InsecureSkipVerify = true
+	case RelayTLSTrustOnFirstUse:
+		// the chain is not verified, only the pinned fingerprint
+		config.InsecureSkipVerify = true
+		config.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return r.checkPin(pins, rawCerts)
+		}
+	default:
+		if r.CAFile != "" {
+			b, err := ioutil.ReadFile(r.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed reading CA bundle: %w", err)
+			}
+			config.RootCAs = x509.NewCertPool()
+			if !config.RootCAs.AppendCertsFromPEM(b) {
+				return nil, fmt.Errorf("no certificates found in CA bundle %s", r.CAFile)
+			}
+		}
+	}
+	if r.CertFile != "" {
+		certificate, err := tls.LoadX509KeyPair(r.CertFile, r.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed loading client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	return config, nil
+}
+
+// checkPin errors if the fingerprint of the relay's certificate differs from
+// the pinned one. Certificates of relays without a pin are accepted here and
+// pinned by pinCertificate once the handshake succeeds.
+func (r Relay) checkPin(pins *Pins, rawCerts [][]byte) error {
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("relay %s presented no certificate", r.Address)
+	}
+	presented := Fingerprint(rawCerts[0])
+	if pinned, ok := pins.Get(r.Address); ok && pinned != presented {
+		return &FingerprintMismatchError{Address: r.Address, Pinned: pinned, Presented: presented}
+	}
+	return nil
+}
+
+// pinCertificate pins the fingerprint of the certificate that the relay
+// presented during a completed handshake if none is pinned yet.
+func (r Relay) pinCertificate(pins *Pins, state tls.ConnectionState) error {
+	if r.TLS != RelayTLSTrustOnFirstUse {
+		return nil
+	}
+	if len(state.PeerCertificates) == 0 {
+		return fmt.Errorf("relay %s presented no certificate", r.Address)
+	}
+	presented := Fingerprint(state.PeerCertificates[0].Raw)
+	pinned, ok := pins.Get(r.Address)
+	if ok {
+		if pinned != presented {
+			return &FingerprintMismatchError{Address: r.Address, Pinned: pinned, Presented: presented}
+		}
+		return nil
+	}
+	log.Printf("Trusting certificate %s of %s on first use", presented, r.Address)
+	return pins.Set(r.Address, presented)
+}
+
+// StartupRelays returns the enabled relays in the configuration followed by
+// those at the given addresses that it doesn't already list. If insecure is
+// set, the added relays accept any certificate.
+func (c *Config) StartupRelays(addresses []string, insecure bool) []Relay {
+	relays := []Relay{}
+	listed := make(map[string]bool)
+	for _, relay := range c.Relays {
+		listed[relay.Address] = true
+		if relay.IsEnabled() {
+			relays = append(relays, relay)
+		}
+	}
+	for _, address := range addresses {
+		if listed[address] {
+			continue
+		}
+		listed[address] = true
+		relay := Relay{Address: address}
+		if insecure {
+			relay.TLS = RelayTLSInsecure
+		}
+		relays = append(relays, relay)
+	}
+	return relays
+}
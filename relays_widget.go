@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"git.sr.ht/~whereswaldon/wisteria/widgets"
+	"github.com/gdamore/tcell"
+)
+
+// relaysHeader is the number of items listed above the relays
+const relaysHeader = 2
+
+// RelaysWidget lists the relays known to a RelayManager. Enter connects to or
+// disconnects from the selected relay, a connects to a new address, w saves
+// the relays to the configuration file, and Esc or q dismisses it.
+type RelaysWidget struct {
+	*widgets.List
+	History *HistoryWidget
+	Manager *RelayManager
+	relays  []RelayState
+}
+
+// NewRelaysWidget creates a widget listing the relays of the manager. New
+// addresses are prompted for by the history widget.
+func NewRelaysWidget(history *HistoryWidget, manager *RelayManager) *RelaysWidget {
+	r := &RelaysWidget{
+		List:    widgets.NewList(),
+		History: history,
+		Manager: manager,
+	}
+	r.Refresh()
+	return r
+}
+
+// Refresh rebuilds the listing from the manager.
+func (r *RelaysWidget) Refresh() {
+	r.relays = r.Manager.Relays()
+	items := make([]string, 0, len(r.relays)+relaysHeader+1)
+	items = append(items,
+		"Relays (Enter to connect or disconnect, a to add, w to save to the config file, Esc to close)",
+		fmt.Sprintf("%-12s  %-15s  %-15s  %8s  %s", "STATE", "SINCE", "LAST NODE", "NODES", "RELAY"))
+	for _, relay := range r.relays {
+		items = append(items, describeRelay(relay))
+	}
+	if len(r.relays) == 0 {
+		items = append(items, "Not connected to any relays; press a to connect to one")
+	}
+	r.SetItems(items)
+}
+
+// describeRelay renders the status of a relay as a row of the table, followed
+// by its last error if it has one.
+func describeRelay(relay RelayState) string {
+	const stamp = "Jan 02 15:04:05"
+	lastNode := "never"
+	if !relay.LastNode.IsZero() {
+		lastNode = relay.LastNode.Local().Format(stamp)
+	}
+	name := relay.Address
+	if relay.Label != "" {
+		name = fmt.Sprintf("%s (%s)", relay.Label, relay.Address)
+	}
+	line := fmt.Sprintf("%-12s  %-15s  %-15s  %8d  %s", relay.State,
+		relay.Since.Local().Format(stamp), lastNode, relay.Nodes, name)
+	if relay.LastError != nil {
+		line += fmt.Sprintf("\n  last error at %s: %v", relay.LastErrorTime.Local().Format(stamp), relay.LastError)
+	}
+	return line
+}
+
+// Draw refreshes the listing and then draws it.
+func (r *RelaysWidget) Draw() {
+	r.Refresh()
+	r.List.Draw()
+}
+
+// toggleSelected connects to the selected relay if it is disconnected, and
+// disconnects from it otherwise.
+func (r *RelaysWidget) toggleSelected() {
+	index := r.Selected() - relaysHeader
+	if index < 0 || index >= len(r.relays) {
+		return
+	}
+	relay := r.relays[index]
+	if relay.Active() {
+		if err := r.Manager.Disconnect(relay.Address); err != nil {
+			log.Printf("Failed disconnecting from relay: %v", err)
+			return
+		}
+		log.Printf("Disconnected from %s", relay.Name())
+		return
+	}
+	if err := r.Manager.Connect(relay.Relay); err != nil {
+		log.Printf("Failed connecting to relay: %v", err)
+		return
+	}
+	log.Printf("Connecting to %s", relay.Name())
+}
+
+// HandleEvent acts on the selected relay, and dismisses the listing on Esc or
+// q.
+func (r *RelaysWidget) HandleEvent(ev tcell.Event) bool {
+	if event, ok := ev.(*tcell.EventKey); ok {
+		switch event.Key() {
+		case tcell.KeyEnter:
+			r.toggleSelected()
+			r.Draw()
+			return true
+		case tcell.KeyEscape:
+			r.PostEvent(widgets.NewEventShowContent(r))
+			return true
+		case tcell.KeyRune:
+			switch event.Rune() {
+			case 'a':
+				// the prompt is shown beneath the history
+				r.PostEvent(widgets.NewEventShowContent(r))
+				r.History.EmitRelayRequest()
+				return true
+			case 'w':
+				if err := r.Manager.Save(); err != nil {
+					log.Printf("Failed saving relays: %v", err)
+				} else {
+					log.Printf("Saved relays to %s", r.Manager.ConfigPath)
+				}
+				return true
+			case 'q':
+				r.PostEvent(widgets.NewEventShowContent(r))
+				return true
+			}
+		}
+	}
+	return r.List.HandleEvent(ev)
+}
@@ -21,8 +21,15 @@ const (
 // renderConfig holds information about how a particular node should be rendered
 type renderConfig struct {
 	state nodeState
+	// guides are drawn before the node's lines to show its position in a tree
+	guides treeGuides
+	// unread nodes are emphasized
+	unread bool
 }
 
+// unreadMarker is appended to the author line of unread replies
+const unreadMarker = " [new]"
+
 // renderNode transforms `node` into a slice of rendered lines, using `store` to look up nodes referenced
 // by `node` and `config` to make style choices.
 func renderNode(node forest.Node, store forest.Store, config renderConfig) ([]RenderedLine, error) {
@@ -58,11 +65,18 @@ func renderNode(node forest.Node, store forest.Store, config renderConfig) ([]Re
 		for rendered[len(rendered)-1] == "\n"[0] {
 			rendered = rendered[:len(rendered)-1]
 		}
-		for _, line := range strings.Split(rendered, "\n") {
+		for i, line := range strings.Split(rendered, "\n") {
+			guide := config.guides.rest
+			if i == 0 {
+				guide = config.guides.first
+			}
+			start := len([]rune(guide))
 			out = append(out, RenderedLine{
 				ID:    n.ID(),
 				Style: style,
-				Text:  []rune(line),
+				Text:  []rune(guide + line),
+				Start: start,
+				End:   start + len([]rune(line)),
 			})
 		}
 		if n.Depth == 1 {
@@ -70,6 +84,12 @@ func renderNode(node forest.Node, store forest.Store, config renderConfig) ([]Re
 		} else {
 			out[0].Style = tcell.StyleDefault
 		}
+		if config.unread {
+			for i := range out {
+				out[i].Style = out[i].Style.Bold(true)
+			}
+			out[0].Text = append(out[0].Text, []rune(unreadMarker)...)
+		}
 	}
 	return out, nil
 }
@@ -10,11 +10,29 @@ import (
 	"git.sr.ht/~whereswaldon/forest-go/store"
 )
 
-// ReplyList holds a sortable list of replies that can update itself
-// automatically by subscribing to a store.ExtendedStore
+// ReplyList holds a list of replies sorted by creation time that can update
+// itself automatically by subscribing to a store.ExtendedStore. Replies are
+// indexed by ID and by community so that lookups and range queries don't
+// need to scan the whole list.
 type ReplyList struct {
 	sync.RWMutex
 	replies []*forest.Reply
+	// byID holds every reply in the list, keyed by the string form of its ID
+	byID map[string]*forest.Reply
+	// byCommunity holds the replies of each community sorted by creation time,
+	// keyed by the string form of the community ID
+	byCommunity map[string][]*forest.Reply
+	// requested is the number of recent replies requested from the store so far
+	requested int
+	// pending holds replies fetched from the store that are older than those in
+	// the list but haven't been added by LoadOlder yet, newest first
+	pending []*forest.Reply
+	// fetchedBefore is the creation time of the oldest reply fetched from the
+	// store, and atBoundary holds the IDs of the fetched replies created then
+	fetchedBefore fields.Timestamp
+	atBoundary    map[string]bool
+	// storeExhausted is set once the store has returned all of its replies
+	storeExhausted bool
 }
 
 // New creates a ReplyList and subscribes it to the provided ExtendedStore.
@@ -36,19 +54,8 @@ func (r *ReplyList) SubscribeTo(s store.ExtendedStore) error {
 	s.SubscribeToNewMessages(func(node forest.Node) {
 		// cannot block in subscription
 		go func() {
-			r.Lock()
-			defer r.Unlock()
 			if reply, ok := node.(*forest.Reply); ok {
-				alreadyInList := false
-				for _, element := range r.replies {
-					if element.Equals(reply) {
-						alreadyInList = true
-						break
-					}
-				}
-				if !alreadyInList {
-					r.replies = append(r.replies, reply)
-				}
+				r.AddReplies(reply)
 			}
 		}()
 	})
@@ -59,21 +66,228 @@ func (r *ReplyList) SubscribeTo(s store.ExtendedStore) error {
 	if err != nil {
 		return fmt.Errorf("Failed loading most recent messages: %w", err)
 	}
+	replies := make([]*forest.Reply, 0, len(nodes))
 	for _, n := range nodes {
 		if reply, ok := n.(*forest.Reply); ok {
-			r.replies = append(r.replies, reply)
+			replies = append(replies, reply)
 		}
 	}
-	r.Sort()
+	r.AddReplies(replies...)
+	r.Lock()
+	r.requested = defaultArchiveReplyListLen
+	r.storeExhausted = len(nodes) < defaultArchiveReplyListLen
+	r.advanceBoundary(replies)
+	r.Unlock()
 	return nil
 }
 
+// LoadOlder adds up to `count` replies older than those previously loaded to the
+// list. It returns the number of replies that were added.
+//
+// The store can only list its most recent replies, so each request reads
+// everything newer than the page as well. To keep paging through a long
+// history cheap, the number of replies requested doubles with each request,
+// and the replies older than the page are kept for the following pages.
+func (r *ReplyList) LoadOlder(s forest.Store, count int) (int, error) {
+	r.RLock()
+	fetch := len(r.pending) < count && !r.storeExhausted
+	quantity := 2 * r.requested
+	if quantity < r.requested+count {
+		quantity = r.requested + count
+	}
+	r.RUnlock()
+	if fetch {
+		nodes, err := s.Recent(fields.NodeTypeReply, quantity)
+		if err != nil {
+			return 0, fmt.Errorf("Failed loading older messages: %w", err)
+		}
+		r.addPending(nodes, quantity)
+	}
+	r.Lock()
+	if count > len(r.pending) {
+		count = len(r.pending)
+	}
+	page := r.pending[:count]
+	r.pending = r.pending[count:]
+	r.Unlock()
+	return r.AddReplies(page...), nil
+}
+
+// addPending keeps the replies among the nodes, which the store returned
+// newest first in response to a request for `quantity` nodes, that are older
+// than any fetched before.
+func (r *ReplyList) addPending(nodes []forest.Node, quantity int) {
+	replies := make([]*forest.Reply, 0, len(nodes))
+	for _, n := range nodes {
+		if reply, ok := n.(*forest.Reply); ok {
+			replies = append(replies, reply)
+		}
+	}
+	r.Lock()
+	defer r.Unlock()
+	if quantity > r.requested {
+		r.requested = quantity
+	}
+	r.storeExhausted = len(nodes) < quantity
+	// skip the replies newer than the boundary, which were fetched before
+	start := sort.Search(len(replies), func(i int) bool {
+		return replies[i].Created <= r.fetchedBefore
+	})
+	older := replies[start:]
+	for _, reply := range older {
+		if reply.Created == r.fetchedBefore && r.atBoundary[reply.ID().String()] {
+			continue
+		}
+		r.pending = append(r.pending, reply)
+	}
+	r.advanceBoundary(older)
+}
+
+// advanceBoundary records the oldest of the replies as the oldest fetched. The
+// caller must hold the lock.
+func (r *ReplyList) advanceBoundary(replies []*forest.Reply) {
+	if len(replies) == 0 {
+		return
+	}
+	oldest := replies[0].Created
+	for _, reply := range replies {
+		if reply.Created < oldest {
+			oldest = reply.Created
+		}
+	}
+	if oldest != r.fetchedBefore || r.atBoundary == nil {
+		r.fetchedBefore = oldest
+		r.atBoundary = make(map[string]bool)
+	}
+	for _, reply := range replies {
+		if reply.Created == oldest {
+			r.atBoundary[reply.ID().String()] = true
+		}
+	}
+}
+
+// Exhausted returns whether every reply in the store has been loaded into
+// the list.
+func (r *ReplyList) Exhausted() bool {
+	r.RLock()
+	defer r.RUnlock()
+	return r.storeExhausted && len(r.pending) == 0
+}
+
+// AddReplies inserts the given replies into the list in creation order,
+// ignoring any that are already present. It returns the number of replies
+// that were actually added.
+func (r *ReplyList) AddReplies(replies ...*forest.Reply) int {
+	r.Lock()
+	defer r.Unlock()
+	if r.byID == nil {
+		r.byID = make(map[string]*forest.Reply)
+		r.byCommunity = make(map[string][]*forest.Reply)
+	}
+	fresh := make([]*forest.Reply, 0, len(replies))
+	for _, reply := range replies {
+		id := reply.ID().String()
+		if _, alreadyInList := r.byID[id]; alreadyInList {
+			continue
+		}
+		r.byID[id] = reply
+		fresh = append(fresh, reply)
+	}
+	if len(fresh) == 0 {
+		return 0
+	}
+	sort.SliceStable(fresh, func(i, j int) bool {
+		return fresh[i].Created < fresh[j].Created
+	})
+	r.replies = mergeSorted(r.replies, fresh)
+	byCommunity := make(map[string][]*forest.Reply)
+	for _, reply := range fresh {
+		community := reply.CommunityID.String()
+		byCommunity[community] = append(byCommunity[community], reply)
+	}
+	for community, added := range byCommunity {
+		r.byCommunity[community] = mergeSorted(r.byCommunity[community], added)
+	}
+	return len(fresh)
+}
+
+// Sort orders the replies by creation time. AddReplies keeps the list sorted,
+// so calling it is never required.
 func (r *ReplyList) Sort() {
 	r.Lock()
 	defer r.Unlock()
-	sort.SliceStable(r.replies, func(i, j int) bool {
-		return r.replies[i].Created < r.replies[j].Created
+	sortReplies(r.replies)
+	for _, replies := range r.byCommunity {
+		sortReplies(replies)
+	}
+}
+
+// sortReplies orders the replies by creation time, keeping replies created
+// at the same time in their current order.
+func sortReplies(replies []*forest.Reply) {
+	sort.SliceStable(replies, func(i, j int) bool {
+		return replies[i].Created < replies[j].Created
+	})
+}
+
+// mergeSorted merges the sorted added replies into the sorted existing ones,
+// placing each after every existing reply created at or before the same time,
+// and returns the resulting slice.
+func mergeSorted(existing, added []*forest.Reply) []*forest.Reply {
+	switch {
+	case len(added) == 1:
+		return insertSorted(existing, added[0])
+	case len(existing) == 0 || existing[len(existing)-1].Created <= added[0].Created:
+		return append(existing, added...)
+	}
+	merged := make([]*forest.Reply, 0, len(existing)+len(added))
+	i, j := 0, 0
+	for i < len(existing) && j < len(added) {
+		if existing[i].Created <= added[j].Created {
+			merged = append(merged, existing[i])
+			i++
+		} else {
+			merged = append(merged, added[j])
+			j++
+		}
+	}
+	merged = append(merged, existing[i:]...)
+	return append(merged, added[j:]...)
+}
+
+// insertSorted inserts the reply into the slice after every reply created
+// at or before the same time and returns the resulting slice.
+func insertSorted(replies []*forest.Reply, reply *forest.Reply) []*forest.Reply {
+	i := sort.Search(len(replies), func(i int) bool {
+		return replies[i].Created > reply.Created
 	})
+	replies = append(replies, nil)
+	copy(replies[i+1:], replies[i:])
+	replies[i] = reply
+	return replies
+}
+
+// between returns the subslice of the sorted replies that were created
+// within [start, end).
+func between(replies []*forest.Reply, start, end fields.Timestamp) []*forest.Reply {
+	low := sort.Search(len(replies), func(i int) bool {
+		return replies[i].Created >= start
+	})
+	high := sort.Search(len(replies), func(i int) bool {
+		return replies[i].Created >= end
+	})
+	if high < low {
+		high = low
+	}
+	return replies[low:high]
+}
+
+// Lookup returns the reply with the given `id` if it is in the ReplyList.
+func (r *ReplyList) Lookup(id *fields.QualifiedHash) (*forest.Reply, bool) {
+	r.RLock()
+	defer r.RUnlock()
+	reply, ok := r.byID[id.String()]
+	return reply, ok
 }
 
 // IndexForID returns the position of the node with the given `id` inside of the ReplyList,
@@ -81,8 +295,16 @@ func (r *ReplyList) Sort() {
 func (r *ReplyList) IndexForID(id *fields.QualifiedHash) int {
 	r.RLock()
 	defer r.RUnlock()
-	for i, n := range r.replies {
-		if n.ID().Equals(id) {
+	reply, ok := r.byID[id.String()]
+	if !ok {
+		return -1
+	}
+	i := sort.Search(len(r.replies), func(i int) bool {
+		return r.replies[i].Created >= reply.Created
+	})
+	// several replies may share a timestamp
+	for ; i < len(r.replies) && r.replies[i].Created == reply.Created; i++ {
+		if r.replies[i] == reply {
 			return i
 		}
 	}
@@ -97,3 +319,30 @@ func (r *ReplyList) WithReplies(closure func(replies []*forest.Reply)) {
 	defer r.RUnlock()
 	closure(r.replies)
 }
+
+// WithRepliesBetween executes an arbitrary closure with access to the replies
+// created within [start, end). The closure must not modify the slice that it
+// is given.
+func (r *ReplyList) WithRepliesBetween(start, end fields.Timestamp, closure func(replies []*forest.Reply)) {
+	r.RLock()
+	defer r.RUnlock()
+	closure(between(r.replies, start, end))
+}
+
+// WithCommunityReplies executes an arbitrary closure with access to the replies
+// within the community with the given ID. The closure must not modify the slice
+// that it is given.
+func (r *ReplyList) WithCommunityReplies(communityID *fields.QualifiedHash, closure func(replies []*forest.Reply)) {
+	r.RLock()
+	defer r.RUnlock()
+	closure(r.byCommunity[communityID.String()])
+}
+
+// WithCommunityRepliesBetween executes an arbitrary closure with access to the
+// replies within the community with the given ID that were created within
+// [start, end). The closure must not modify the slice that it is given.
+func (r *ReplyList) WithCommunityRepliesBetween(communityID *fields.QualifiedHash, start, end fields.Timestamp, closure func(replies []*forest.Reply)) {
+	r.RLock()
+	defer r.RUnlock()
+	closure(between(r.byCommunity[communityID.String()], start, end))
+}
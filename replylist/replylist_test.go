@@ -0,0 +1,355 @@
+package replylist
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	forest "git.sr.ht/~whereswaldon/forest-go"
+	"git.sr.ht/~whereswaldon/forest-go/fields"
+	"git.sr.ht/~whereswaldon/forest-go/store"
+	"git.sr.ht/~whereswaldon/forest-go/testutil"
+)
+
+// base is an arbitrary creation time that the test replies are created after
+const base = fields.Timestamp(1500000000000)
+
+// grove creates replies in two communities with chosen creation times.
+type grove struct {
+	// templates holds a reply in each community to derive others from
+	templates []*forest.Reply
+	count     int
+}
+
+func newGrove(t *testing.T) *grove {
+	identity, signer, community := testutil.MakeCommunityOrSkip(t)
+	builder := forest.As(identity, signer)
+	other, err := builder.NewCommunity("other", []byte{})
+	if err != nil {
+		t.Fatalf("failed creating community: %v", err)
+	}
+	g := &grove{}
+	for _, c := range []*forest.Community{community, other} {
+		reply, err := builder.NewReply(c, "template", []byte{})
+		if err != nil {
+			t.Fatalf("failed creating reply: %v", err)
+		}
+		g.templates = append(g.templates, reply)
+	}
+	return g
+}
+
+// reply creates a distinct reply in the community with the given index that
+// claims to have been created at the given time. Its signature is not valid,
+// which neither the ReplyList nor a MemoryStore checks.
+func (g *grove) reply(t *testing.T, community int, created fields.Timestamp) *forest.Reply {
+	g.count++
+	reply := *g.templates[community]
+	reply.Created = created
+	reply.Content = *testutil.QualifiedContentOrSkip(t, fields.ContentTypeUTF8String, []byte(fmt.Sprintf("reply %d", g.count)))
+	b, err := reply.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed encoding reply: %v", err)
+	}
+	derived, err := forest.UnmarshalReply(b)
+	if err != nil {
+		t.Fatalf("failed decoding reply: %v", err)
+	}
+	return derived
+}
+
+// expectReplies checks that the replies are exactly the expected ones in order.
+func expectReplies(t *testing.T, replies, expected []*forest.Reply) {
+	t.Helper()
+	if len(replies) != len(expected) {
+		t.Fatalf("expected %d replies, got %d", len(expected), len(replies))
+	}
+	for i := range expected {
+		if !replies[i].ID().Equals(expected[i].ID()) {
+			t.Errorf("expected reply %d to be %s created at %d, got %s created at %d", i,
+				expected[i].ID(), expected[i].Created, replies[i].ID(), replies[i].Created)
+		}
+	}
+}
+
+// contents returns the replies within the list.
+func contents(r *ReplyList) []*forest.Reply {
+	var out []*forest.Reply
+	r.WithReplies(func(replies []*forest.Reply) {
+		out = append(out, replies...)
+	})
+	return out
+}
+
+func TestAddRepliesKeepsOrder(t *testing.T) {
+	g := newGrove(t)
+	first, third, fifth := g.reply(t, 0, base+1), g.reply(t, 0, base+3), g.reply(t, 0, base+5)
+	r := new(ReplyList)
+	if added := r.AddReplies(fifth, first, third); added != 3 {
+		t.Fatalf("expected 3 replies added, got %d", added)
+	}
+	expectReplies(t, contents(r), []*forest.Reply{first, third, fifth})
+
+	// a single reply lands between the existing ones
+	fourth := g.reply(t, 0, base+4)
+	r.AddReplies(fourth)
+	expectReplies(t, contents(r), []*forest.Reply{first, third, fourth, fifth})
+
+	// a batch is merged around and between the existing ones
+	zeroth, second, sixth := g.reply(t, 0, base), g.reply(t, 0, base+2), g.reply(t, 0, base+6)
+	if added := r.AddReplies(sixth, second, zeroth); added != 3 {
+		t.Fatalf("expected 3 replies added, got %d", added)
+	}
+	expectReplies(t, contents(r), []*forest.Reply{zeroth, first, second, third, fourth, fifth, sixth})
+
+	// replies already present are ignored
+	if added := r.AddReplies(third, g.reply(t, 0, base+7), third); added != 1 {
+		t.Errorf("expected only the new reply to be added, got %d", added)
+	}
+	if length := len(contents(r)); length != 8 {
+		t.Errorf("expected 8 replies, got %d", length)
+	}
+}
+
+func TestEqualTimestampsStayInOrder(t *testing.T) {
+	g := newGrove(t)
+	a, b, c, d := g.reply(t, 0, base), g.reply(t, 0, base), g.reply(t, 0, base), g.reply(t, 0, base)
+	r := new(ReplyList)
+	r.AddReplies(a, b)
+	r.AddReplies(c)
+	r.AddReplies(d, g.reply(t, 0, base-1))
+	replies := contents(r)
+	expectReplies(t, replies[1:], []*forest.Reply{a, b, c, d})
+	for i, reply := range replies[1:] {
+		if index := r.IndexForID(reply.ID()); index != i+1 {
+			t.Errorf("expected reply %d to be at index %d, got %d", i, i+1, index)
+		}
+	}
+	if index := r.IndexForID(g.reply(t, 0, base).ID()); index != -1 {
+		t.Errorf("expected a missing reply at index -1, got %d", index)
+	}
+	if reply, ok := r.Lookup(c.ID()); !ok || reply != c {
+		t.Errorf("failed looking up reply by ID")
+	}
+}
+
+func TestInsertSorted(t *testing.T) {
+	g := newGrove(t)
+	var replies []*forest.Reply
+	for _, created := range []fields.Timestamp{base + 3, base + 1, base + 2, base + 1, base + 4, base} {
+		replies = insertSorted(replies, g.reply(t, 0, created))
+	}
+	for i := 1; i < len(replies); i++ {
+		if replies[i-1].Created > replies[i].Created {
+			t.Fatalf("replies out of order at %d", i)
+		}
+	}
+	// the later of the two replies created at base+1 was inserted after
+	if string(replies[1].Content.Blob) != "reply 2" || string(replies[2].Content.Blob) != "reply 4" {
+		t.Errorf("replies created at the same time were reordered")
+	}
+}
+
+func TestMergeSorted(t *testing.T) {
+	g := newGrove(t)
+	existing := []*forest.Reply{g.reply(t, 0, base+1), g.reply(t, 0, base+3), g.reply(t, 0, base+5)}
+	added := []*forest.Reply{g.reply(t, 0, base), g.reply(t, 0, base+3), g.reply(t, 0, base+4), g.reply(t, 0, base+6)}
+	merged := mergeSorted(append([]*forest.Reply{}, existing...), added)
+	expectReplies(t, merged, []*forest.Reply{added[0], existing[0], existing[1], added[1], added[2], existing[2], added[3]})
+
+	// replies newer than every existing one are appended
+	newer := []*forest.Reply{g.reply(t, 0, base+7), g.reply(t, 0, base+8)}
+	expectReplies(t, mergeSorted(merged, newer), append(merged, newer...))
+}
+
+func TestRangeQueries(t *testing.T) {
+	g := newGrove(t)
+	r := new(ReplyList)
+	var inFirst []*forest.Reply
+	for i := 0; i < 6; i++ {
+		reply := g.reply(t, i%2, base+fields.Timestamp(i))
+		if i%2 == 0 {
+			inFirst = append(inFirst, reply)
+		}
+		r.AddReplies(reply)
+	}
+	r.WithRepliesBetween(base+2, base+5, func(replies []*forest.Reply) {
+		if len(replies) != 3 || replies[0].Created != base+2 || replies[2].Created != base+4 {
+			t.Errorf("expected the replies created within [2, 5), got %d", len(replies))
+		}
+	})
+	r.WithRepliesBetween(base+5, base+2, func(replies []*forest.Reply) {
+		if len(replies) != 0 {
+			t.Errorf("expected no replies in an empty range, got %d", len(replies))
+		}
+	})
+	community := &inFirst[0].CommunityID
+	r.WithCommunityReplies(community, func(replies []*forest.Reply) {
+		expectReplies(t, replies, inFirst)
+	})
+	r.WithCommunityRepliesBetween(community, base+1, base+4, func(replies []*forest.Reply) {
+		expectReplies(t, replies, inFirst[1:2])
+	})
+}
+
+// newStore creates a store holding the replies.
+func newStore(t *testing.T, replies []*forest.Reply) *store.Archive {
+	s := store.NewArchive(store.NewMemoryStore())
+	for _, reply := range replies {
+		if err := s.Add(reply); err != nil {
+			t.Fatalf("failed storing reply: %v", err)
+		}
+	}
+	return s
+}
+
+func TestSubscribeTo(t *testing.T) {
+	g := newGrove(t)
+	var replies []*forest.Reply
+	for i := 0; i < 10; i++ {
+		replies = append(replies, g.reply(t, 0, base+fields.Timestamp(i)))
+	}
+	s := newStore(t, replies[:9])
+	r, err := New(s)
+	if err != nil {
+		t.Fatalf("failed creating list: %v", err)
+	}
+	expectReplies(t, contents(r), replies[:9])
+	if !r.Exhausted() {
+		t.Errorf("expected a small store to be loaded entirely")
+	}
+	if err := s.Add(replies[9]); err != nil {
+		t.Fatalf("failed storing reply: %v", err)
+	}
+	for i := 0; i < 100 && r.IndexForID(replies[9].ID()) < 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if index := r.IndexForID(replies[9].ID()); index != 9 {
+		t.Errorf("expected a new reply in the store to be added at 9, got %d", index)
+	}
+}
+
+// recordingStore records the quantity of every request for recent nodes.
+type recordingStore struct {
+	forest.Store
+	requests []int
+}
+
+func (s *recordingStore) Recent(nodeType fields.NodeType, quantity int) ([]forest.Node, error) {
+	s.requests = append(s.requests, quantity)
+	return s.Store.Recent(nodeType, quantity)
+}
+
+// loadAll pages through the older replies `count` at a time until the list is
+// exhausted, checking that every page but the last is full.
+func loadAll(t *testing.T, r *ReplyList, s forest.Store, count, remaining int) {
+	t.Helper()
+	for !r.Exhausted() {
+		added, err := r.LoadOlder(s, count)
+		if err != nil {
+			t.Fatalf("failed loading older replies: %v", err)
+		}
+		expected := count
+		if remaining < count {
+			expected = remaining
+		}
+		if added != expected {
+			t.Fatalf("expected a page of %d replies with %d remaining, got %d", expected, remaining, added)
+		}
+		remaining -= added
+	}
+	if remaining != 0 {
+		t.Errorf("exhausted with %d replies never loaded", remaining)
+	}
+}
+
+func TestLoadOlderAcrossEqualTimestamps(t *testing.T) {
+	g := newGrove(t)
+	var replies []*forest.Reply
+	for i := 0; i < 1100; i++ {
+		created := base + fields.Timestamp(i)
+		if i >= 75 && i < 80 {
+			// the first request for 1024 replies gets only four of these
+			created = base + 75
+		}
+		replies = append(replies, g.reply(t, 0, created))
+	}
+	s := newStore(t, replies)
+	r, err := New(s)
+	if err != nil {
+		t.Fatalf("failed creating list: %v", err)
+	}
+	if length := len(contents(r)); length != 1024 {
+		t.Fatalf("expected 1024 replies at first, got %d", length)
+	}
+	if r.Exhausted() {
+		t.Fatalf("expected older replies to remain")
+	}
+	loadAll(t, r, s, 10, 1100-1024)
+	loaded := contents(r)
+	for i := 1; i < len(loaded); i++ {
+		if loaded[i-1].Created > loaded[i].Created {
+			t.Fatalf("replies out of order at %d", i)
+		}
+	}
+	for _, reply := range replies {
+		if r.IndexForID(reply.ID()) < 0 {
+			t.Errorf("reply created at %d was never loaded", reply.Created)
+		}
+	}
+}
+
+func TestLoadOlderPages(t *testing.T) {
+	g := newGrove(t)
+	var replies []*forest.Reply
+	for i := 0; i < 2100; i++ {
+		replies = append(replies, g.reply(t, 0, base+fields.Timestamp(i)))
+	}
+	s := &recordingStore{Store: newStore(t, replies)}
+	r, err := New(s.Store.(*store.Archive))
+	if err != nil {
+		t.Fatalf("failed creating list: %v", err)
+	}
+	// the first page fetches twice as many replies as were requested before,
+	// and the pages after it are served from those until they run out
+	for i := 0; i < 5; i++ {
+		if added, err := r.LoadOlder(s, 10); err != nil || added != 10 {
+			t.Fatalf("expected a page of 10 replies, got %d: %v", added, err)
+		}
+	}
+	if len(s.requests) != 1 || s.requests[0] != 2048 {
+		t.Fatalf("expected a single request for 2048 replies, got %v", s.requests)
+	}
+	expectReplies(t, contents(r)[:2], replies[2100-1074:2100-1072])
+	loadAll(t, r, s, 1000, 2100-1074)
+	if len(s.requests) != 2 || s.requests[1] != 4096 {
+		t.Errorf("expected a second request for 4096 replies, got %v", s.requests)
+	}
+	expectReplies(t, contents(r), replies)
+	if added, err := r.LoadOlder(s, 10); err != nil || added != 0 || len(s.requests) != 2 {
+		t.Errorf("expected an exhausted list to add nothing without asking the store, added %d: %v", added, err)
+	}
+}
+
+func TestLoadOlderExactlyOnePage(t *testing.T) {
+	g := newGrove(t)
+	var replies []*forest.Reply
+	for i := 0; i < 1024; i++ {
+		replies = append(replies, g.reply(t, 0, base+fields.Timestamp(i)))
+	}
+	s := newStore(t, replies)
+	r, err := New(s)
+	if err != nil {
+		t.Fatalf("failed creating list: %v", err)
+	}
+	if r.Exhausted() {
+		t.Fatalf("expected a full first page to leave the store unexhausted")
+	}
+	if added, err := r.LoadOlder(s, 10); err != nil || added != 0 {
+		t.Errorf("expected no older replies, got %d: %v", added, err)
+	}
+	if !r.Exhausted() {
+		t.Errorf("expected the list to be exhausted")
+	}
+	expectReplies(t, contents(r), replies)
+}
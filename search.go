@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Search is a query for messages whose content or author name matches a pattern.
+//
+// Queries are plain text by default, and ignore case unless they contain an
+// uppercase letter. As in vim, these behaviors can be changed by including
+// these sequences anywhere in the query:
+//
+//	\c  ignore case
+//	\C  match case
+//	\v  interpret the query as a regular expression
+type Search struct {
+	// Query is the text that the user searched for
+	Query string
+	// Text is the Query without any of the sequences that change its behavior
+	Text       string
+	IgnoreCase bool
+	Regexp     bool
+	pattern    *regexp.Regexp
+}
+
+// NewSearch parses a query into a Search, returning an error if it is an invalid
+// regular expression.
+func NewSearch(query string) (*Search, error) {
+	s := &Search{Query: query}
+	text := query
+	caseSet := false
+	for _, flag := range []string{`\c`, `\C`, `\v`} {
+		if !strings.Contains(text, flag) {
+			continue
+		}
+		text = strings.ReplaceAll(text, flag, "")
+		switch flag {
+		case `\c`:
+			s.IgnoreCase, caseSet = true, true
+		case `\C`:
+			s.IgnoreCase, caseSet = false, true
+		case `\v`:
+			s.Regexp = true
+		}
+	}
+	if text == "" {
+		return nil, fmt.Errorf("empty search")
+	}
+	s.Text = text
+	if !caseSet {
+		s.IgnoreCase = !hasUpperLiteral(text, s.Regexp)
+	}
+	if !s.Regexp {
+		text = regexp.QuoteMeta(text)
+	}
+	// anchors match at the start and end of each line, which is how matches
+	// are highlighted
+	text = "(?m)" + text
+	if s.IgnoreCase {
+		text = "(?i)" + text
+	}
+	pattern, err := regexp.Compile(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression: %w", err)
+	}
+	s.pattern = pattern
+	return s, nil
+}
+
+// hasUpperLiteral returns whether the query contains an uppercase letter that
+// it matches literally. In a regular expression, the letters of escapes like
+// \S, class names like \p{Greek}, and group names don't count.
+func hasUpperLiteral(query string, isRegexp bool) bool {
+	runes := []rune(query)
+	for i := 0; i < len(runes); i++ {
+		switch {
+		case isRegexp && runes[i] == '\\' && i+1 < len(runes):
+			i++
+			if (runes[i] == 'p' || runes[i] == 'P') && i+1 < len(runes) {
+				i++
+				if runes[i] == '{' {
+					for i < len(runes) && runes[i] != '}' {
+						i++
+					}
+				}
+			}
+		case isRegexp && strings.HasPrefix(string(runes[i:]), "(?P<"):
+			for i < len(runes) && runes[i] != '>' {
+				i++
+			}
+		case unicode.IsUpper(runes[i]):
+			return true
+		}
+	}
+	return false
+}
+
+// Matches returns whether any of the provided texts match the search.
+func (s *Search) Matches(texts ...string) bool {
+	for _, text := range texts {
+		if s.pattern.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// span is a range of runes [start, end) within a line of text
+type span struct {
+	start, end int
+}
+
+// spans returns the ranges of runes within the line that match the search.
+func (s *Search) spans(line []rune) []span {
+	text := string(line)
+	matches := s.pattern.FindAllStringIndex(text, -1)
+	if len(matches) == 0 {
+		return nil
+	}
+	out := make([]span, 0, len(matches))
+	for _, match := range matches {
+		if match[0] == match[1] {
+			// empty matches are invisible
+			continue
+		}
+		out = append(out, span{
+			start: utf8.RuneCountInString(text[:match[0]]),
+			end:   utf8.RuneCountInString(text[:match[1]]),
+		})
+	}
+	return out
+}
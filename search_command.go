@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	forest "git.sr.ht/~whereswaldon/forest-go"
+	"git.sr.ht/~whereswaldon/forest-go/fields"
+	"git.sr.ht/~whereswaldon/forest-go/grove"
+	"git.sr.ht/~whereswaldon/wisteria/searchindex"
+)
+
+// searchDateFormats are the formats accepted by the date filters of the
+// search subcommand
+var searchDateFormats = []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02"}
+
+// parseSearchDate parses a date given to the search subcommand in the local
+// time zone.
+func parseSearchDate(input string) (time.Time, error) {
+	for _, format := range searchDateFormats {
+		if t, err := time.ParseInLocation(format, input, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date %q (try YYYY-MM-DD)", input)
+}
+
+// RunSearchCommand implements `wisteria search`, which prints the replies in
+// the grove matching the search terms and filters given in args.
+func RunSearchCommand(args []string, defaultGrovePath string, out io.Writer) error {
+	flags := flag.NewFlagSet("search", flag.ContinueOnError)
+	grovepath := flags.String("grove", defaultGrovePath, "path to the grove to search (directory of arbor history)")
+	author := flags.String("author", "", "only show replies by the author with this name or ID")
+	community := flags.String("community", "", "only show replies in the community with this name or ID")
+	since := flags.String("since", "", "only show replies written at or after this date")
+	until := flags.String("until", "", "only show replies written before this date")
+	limit := flags.Int("limit", 50, "the largest number of replies to show (0 for no limit)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), `Usage of search:
+
+%s search [flags] [term...]
+
+Prints the replies whose content contains words beginning with every term,
+newest first. Dates are written like 2006-01-02 or 2006-01-02T15:04.
+
+`, os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	query := searchindex.Query{
+		Text:      strings.Join(flags.Args(), " "),
+		Author:    *author,
+		Community: *community,
+		Limit:     *limit,
+	}
+	var err error
+	if *since != "" {
+		if query.Since, err = parseSearchDate(*since); err != nil {
+			return err
+		}
+	}
+	if *until != "" {
+		if query.Until, err = parseSearchDate(*until); err != nil {
+			return err
+		}
+	}
+
+	groveStore, err := grove.New(*grovepath)
+	if err != nil {
+		return fmt.Errorf("failed opening grove at %s: %w", *grovepath, err)
+	}
+	index, err := searchindex.Open(SearchIndexDirectory(*grovepath))
+	if err != nil {
+		return fmt.Errorf("failed opening search index: %w", err)
+	}
+	defer index.Close()
+	// catch up on anything written while wisteria wasn't running
+	if _, err := index.Build(*grovepath, groveStore); err != nil {
+		return fmt.Errorf("failed updating search index: %w", err)
+	}
+	for _, doc := range index.Search(query) {
+		content := ""
+		id := &fields.QualifiedHash{}
+		if err := id.UnmarshalText([]byte(doc.ID)); err == nil {
+			if node, has, err := groveStore.Get(id); err == nil && has {
+				if reply, ok := node.(*forest.Reply); ok {
+					content = string(reply.Content.Blob)
+				}
+			}
+		}
+		fmt.Fprintf(out, "%s %s in %s (%s)\n", doc.Created.Time().Local().Format("2006-01-02 15:04"), doc.AuthorName, doc.CommunityName, doc.ID)
+		for _, line := range strings.Split(strings.TrimRight(content, "\n"), "\n") {
+			fmt.Fprintf(out, "    %s\n", line)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func TestSearchSmartCase(t *testing.T) {
+	for _, test := range []struct {
+		query      string
+		ignoreCase bool
+	}{
+		{"hello", true},
+		{"Hello", false},
+		{`\S+`, false},
+		{`\vfoo\S+\W`, true},
+		{`\v\p{Greek}\pL`, true},
+		{`\v(?P<Name>x)`, true},
+		{`\vFoo\S`, false},
+		{`\v\\A`, false},
+		{`Hello\c`, true},
+		{`hello\C`, false},
+	} {
+		search, err := NewSearch(test.query)
+		if err != nil {
+			t.Errorf("failed parsing %q: %v", test.query, err)
+			continue
+		}
+		if search.IgnoreCase != test.ignoreCase {
+			t.Errorf("expected %q to have IgnoreCase %v", test.query, test.ignoreCase)
+		}
+	}
+}
+
+func TestSearchSpans(t *testing.T) {
+	for _, test := range []struct {
+		query, line string
+		spans       []span
+	}{
+		{"b", "abcb", []span{{1, 2}, {3, 4}}},
+		{`\v^a`, "abca", []span{{0, 1}}},
+		{`\va$`, "abca", []span{{3, 4}}},
+		{"é", "aéé", []span{{1, 2}, {2, 3}}},
+		{`\vx*`, "abc", []span{}},
+	} {
+		search, err := NewSearch(test.query)
+		if err != nil {
+			t.Errorf("failed parsing %q: %v", test.query, err)
+			continue
+		}
+		spans := search.spans([]rune(test.line))
+		if len(spans) != len(test.spans) {
+			t.Errorf("expected %q to match %q at %v, got %v", test.query, test.line, test.spans, spans)
+			continue
+		}
+		for i := range spans {
+			if spans[i] != test.spans[i] {
+				t.Errorf("expected %q to match %q at %v, got %v", test.query, test.line, test.spans, spans)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,27 @@
+//go:build !windows
+// +build !windows
+
+package searchindex
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile opens the file at the path, creating it if necessary, and takes an
+// exclusive lock on it that is released when the file is closed. It returns
+// errLocked if another process holds the lock.
+func lockFile(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0660)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, errLocked
+		}
+		return nil, err
+	}
+	return file, nil
+}
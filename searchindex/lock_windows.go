@@ -0,0 +1,29 @@
+package searchindex
+
+import (
+	"os"
+	"syscall"
+)
+
+// errorSharingViolation is returned when opening a file that another process
+// has opened without sharing it
+const errorSharingViolation syscall.Errno = 32
+
+// lockFile opens the file at the path, creating it if necessary, without
+// sharing it with other processes until it is closed. It returns errLocked if
+// another process has it open.
+func lockFile(path string) (*os.File, error) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	handle, err := syscall.CreateFile(name, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil,
+		syscall.OPEN_ALWAYS, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		if err == errorSharingViolation {
+			return nil, errLocked
+		}
+		return nil, err
+	}
+	return os.NewFile(uintptr(handle), path), nil
+}
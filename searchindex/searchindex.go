@@ -0,0 +1,481 @@
+// Package searchindex maintains a persistent full-text index of the replies in
+// a grove so that they can be searched without loading them all.
+//
+// The index lives in its own directory as an inverted index (a map from each
+// term to the replies containing it) snapshot along with a journal of the
+// replies indexed since the snapshot was taken. The journal is folded into a
+// new snapshot once it grows large and whenever the index is closed.
+//
+// Only one process at a time may write to the index. Others open it read-only
+// and keep anything they index in memory.
+package searchindex
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	forest "git.sr.ht/~whereswaldon/forest-go"
+	"git.sr.ht/~whereswaldon/forest-go/fields"
+	"git.sr.ht/~whereswaldon/wisteria/atomicfile"
+)
+
+const (
+	snapshotName = "index.gob"
+	journalName  = "journal.jsonl"
+	lockName     = "lock"
+	// compactThreshold is the number of journal entries that triggers writing
+	// a new snapshot
+	compactThreshold = 4096
+)
+
+// errLocked reports that another process holds the lock on an index
+var errLocked = errors.New("index is locked by another process")
+
+// Doc describes an indexed reply.
+type Doc struct {
+	ID            string
+	Author        string
+	AuthorName    string
+	Community     string
+	CommunityName string
+	Created       fields.Timestamp
+}
+
+// snapshot is the on-disk form of the index
+type snapshot struct {
+	Docs []Doc
+	// Postings maps each term to the ascending indices within Docs of the
+	// replies containing it
+	Postings map[string][]int
+}
+
+// journalEntry records a reply indexed since the last snapshot
+type journalEntry struct {
+	Doc
+	// Created replaces Doc.Created, whose JSON form cannot be decoded
+	Created uint64
+	Terms   []string
+}
+
+// Index is a full-text index of replies that is persisted in a directory.
+// It is safe for concurrent use.
+type Index struct {
+	sync.RWMutex
+	Directory string
+	// ReadOnly is set if another process was writing to the index when it was
+	// opened. Replies added to a read-only index are not saved.
+	ReadOnly bool
+
+	docs     []Doc
+	byID     map[string]int
+	postings map[string][]int
+	// terms holds the keys of postings in sorted order, or nil if it needs to
+	// be recomputed
+	terms     []string
+	journal   *os.File
+	journaled int
+	// lock holds the lock file unless the index is read-only
+	lock *os.File
+}
+
+// Open loads the index stored in the given directory, creating an empty one if
+// there is none. If another process has the index open, it is opened
+// read-only.
+func Open(directory string) (*Index, error) {
+	if err := os.MkdirAll(directory, 0770); err != nil {
+		return nil, fmt.Errorf("failed creating index directory %s: %w", directory, err)
+	}
+	ix := &Index{
+		Directory: directory,
+		byID:      make(map[string]int),
+		postings:  make(map[string][]int),
+	}
+	lock, err := lockFile(filepath.Join(directory, lockName))
+	if errors.Is(err, errLocked) {
+		ix.ReadOnly = true
+	} else if err != nil {
+		return nil, fmt.Errorf("failed locking index: %w", err)
+	}
+	ix.lock = lock
+	if err := ix.load(); err != nil {
+		ix.unlock()
+		return nil, err
+	}
+	return ix, nil
+}
+
+// load reads the snapshot and journal, and then opens the journal for
+// writing unless the index is read-only.
+func (ix *Index) load() error {
+	if err := ix.loadSnapshot(); err != nil {
+		return err
+	}
+	if err := ix.replayJournal(); err != nil {
+		return err
+	}
+	if ix.ReadOnly {
+		return nil
+	}
+	journal, err := os.OpenFile(filepath.Join(ix.Directory, journalName), os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0660)
+	if err != nil {
+		return fmt.Errorf("failed opening index journal: %w", err)
+	}
+	ix.journal = journal
+	return nil
+}
+
+// unlock releases the lock file, if it is held.
+func (ix *Index) unlock() error {
+	if ix.lock == nil {
+		return nil
+	}
+	err := ix.lock.Close()
+	ix.lock = nil
+	return err
+}
+
+// loadSnapshot reads the most recent snapshot, if there is one.
+func (ix *Index) loadSnapshot() error {
+	file, err := os.Open(filepath.Join(ix.Directory, snapshotName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed opening index snapshot: %w", err)
+	}
+	defer file.Close()
+	var snap snapshot
+	if err := gob.NewDecoder(bufio.NewReader(file)).Decode(&snap); err != nil {
+		return fmt.Errorf("failed decoding index snapshot: %w", err)
+	}
+	ix.docs = snap.Docs
+	for i, doc := range ix.docs {
+		ix.byID[doc.ID] = i
+	}
+	if snap.Postings != nil {
+		ix.postings = snap.Postings
+	}
+	return nil
+}
+
+// replayJournal indexes the replies recorded in the journal.
+func (ix *Index) replayJournal() error {
+	file, err := os.Open(filepath.Join(ix.Directory, journalName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed opening index journal: %w", err)
+	}
+	defer file.Close()
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	for decoder.More() {
+		var entry journalEntry
+		if err := decoder.Decode(&entry); err != nil {
+			// a partially-written final entry is expected after a crash, and the
+			// reply will simply be indexed again
+			break
+		}
+		entry.Doc.Created = fields.Timestamp(entry.Created)
+		ix.insert(entry.Doc, entry.Terms)
+		ix.journaled++
+	}
+	return nil
+}
+
+// insert adds the doc to the in-memory index unless it is already present. It
+// returns whether the doc was added. The caller must hold the write lock.
+func (ix *Index) insert(doc Doc, terms []string) bool {
+	if _, ok := ix.byID[doc.ID]; ok {
+		return false
+	}
+	position := len(ix.docs)
+	ix.docs = append(ix.docs, doc)
+	ix.byID[doc.ID] = position
+	for _, term := range terms {
+		if _, ok := ix.postings[term]; !ok {
+			ix.terms = nil
+		}
+		ix.postings[term] = append(ix.postings[term], position)
+	}
+	return true
+}
+
+// Len returns the number of indexed replies.
+func (ix *Index) Len() int {
+	ix.RLock()
+	defer ix.RUnlock()
+	return len(ix.docs)
+}
+
+// Has returns whether the reply with the given ID is indexed.
+func (ix *Index) Has(id string) bool {
+	ix.RLock()
+	defer ix.RUnlock()
+	_, ok := ix.byID[id]
+	return ok
+}
+
+// Add indexes the reply, using the store to look up the names of its author
+// and community. Replies that are already indexed are ignored.
+func (ix *Index) Add(reply *forest.Reply, s forest.Store) error {
+	id := reply.ID().String()
+	if ix.Has(id) {
+		return nil
+	}
+	doc := Doc{
+		ID:        id,
+		Author:    reply.Author.String(),
+		Community: reply.CommunityID.String(),
+		Created:   reply.Created,
+	}
+	if author, has, err := s.GetIdentity(&reply.Author); err != nil {
+		return fmt.Errorf("failed looking up author of %s: %w", id, err)
+	} else if has {
+		doc.AuthorName = string(author.(*forest.Identity).Name.Blob)
+	}
+	if community, has, err := s.GetCommunity(&reply.CommunityID); err != nil {
+		return fmt.Errorf("failed looking up community of %s: %w", id, err)
+	} else if has {
+		doc.CommunityName = string(community.(*forest.Community).Name.Blob)
+	}
+	terms := Tokenize(string(reply.Content.Blob))
+
+	ix.Lock()
+	defer ix.Unlock()
+	if !ix.insert(doc, terms) || ix.ReadOnly {
+		return nil
+	}
+	entry, err := json.Marshal(journalEntry{Doc: doc, Created: uint64(doc.Created), Terms: terms})
+	if err != nil {
+		return fmt.Errorf("failed encoding index journal entry: %w", err)
+	}
+	if _, err := ix.journal.Write(append(entry, '\n')); err != nil {
+		return fmt.Errorf("failed writing index journal: %w", err)
+	}
+	ix.journaled++
+	if ix.journaled >= compactThreshold {
+		return ix.compact()
+	}
+	return nil
+}
+
+// Build indexes every reply stored in the files of the grove directory that
+// isn't already indexed, using the store to look up author and community names.
+// It returns the number of replies that were added.
+func (ix *Index) Build(groveDirectory string, s forest.Store) (int, error) {
+	infos, err := ioutil.ReadDir(groveDirectory)
+	if err != nil {
+		return 0, fmt.Errorf("failed listing grove: %w", err)
+	}
+	added := 0
+	for _, info := range infos {
+		// grove files are named for the ID of the node that they hold
+		if info.IsDir() || ix.Has(info.Name()) {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(groveDirectory, info.Name()))
+		if err != nil {
+			return added, fmt.Errorf("failed reading %s: %w", info.Name(), err)
+		}
+		node, err := forest.UnmarshalBinaryNode(b)
+		if err != nil {
+			// not every file in the grove is a node
+			continue
+		}
+		reply, ok := node.(*forest.Reply)
+		if !ok {
+			continue
+		}
+		before := ix.Len()
+		if err := ix.Add(reply, s); err != nil {
+			return added, err
+		}
+		added += ix.Len() - before
+	}
+	return added, nil
+}
+
+// Compact folds the journal into a new snapshot.
+func (ix *Index) Compact() error {
+	ix.Lock()
+	defer ix.Unlock()
+	return ix.compact()
+}
+
+// compact folds the journal into a new snapshot. The caller must hold the write
+// lock.
+func (ix *Index) compact() error {
+	if ix.journaled == 0 || ix.ReadOnly {
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(snapshot{Docs: ix.docs, Postings: ix.postings}); err != nil {
+		return fmt.Errorf("failed encoding index snapshot: %w", err)
+	}
+	if err := atomicfile.WriteFile(filepath.Join(ix.Directory, snapshotName), buf.Bytes(), 0660); err != nil {
+		return fmt.Errorf("failed saving index snapshot: %w", err)
+	}
+	if err := ix.journal.Truncate(0); err != nil {
+		return fmt.Errorf("failed truncating index journal: %w", err)
+	}
+	ix.journaled = 0
+	return nil
+}
+
+// Close writes a new snapshot if necessary and releases the journal and the
+// lock.
+func (ix *Index) Close() error {
+	ix.Lock()
+	defer ix.Unlock()
+	if ix.ReadOnly {
+		return nil
+	}
+	err := ix.compact()
+	if closeErr := ix.journal.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed closing index journal: %w", closeErr)
+	}
+	if unlockErr := ix.unlock(); err == nil && unlockErr != nil {
+		err = fmt.Errorf("failed releasing index lock: %w", unlockErr)
+	}
+	return err
+}
+
+// Tokenize splits text into the lowercase terms that are indexed.
+func Tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	seen := make(map[string]struct{}, len(words))
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		if _, ok := seen[word]; ok {
+			continue
+		}
+		seen[word] = struct{}{}
+		terms = append(terms, word)
+	}
+	return terms
+}
+
+// Query describes the replies to search for. Zero-valued fields do not
+// restrict the results.
+type Query struct {
+	// Text must be found in the content of matching replies. Each of its terms
+	// must begin a word in the content.
+	Text string
+	// Author is the name or ID of the author of matching replies
+	Author string
+	// Community is the name or ID of the community of matching replies
+	Community string
+	// Since and Until bound the creation time of matching replies
+	Since, Until time.Time
+	// Limit is the largest number of results to return
+	Limit int
+}
+
+// matches returns whether the doc satisfies the query's filters.
+func (q Query) matches(doc Doc) bool {
+	if q.Author != "" && q.Author != doc.Author && !strings.EqualFold(q.Author, doc.AuthorName) {
+		return false
+	}
+	if q.Community != "" && q.Community != doc.Community && !strings.EqualFold(q.Community, doc.CommunityName) {
+		return false
+	}
+	if !q.Since.IsZero() && doc.Created < fields.TimestampFrom(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && doc.Created >= fields.TimestampFrom(q.Until) {
+		return false
+	}
+	return true
+}
+
+// Search returns the replies matching the query, newest first.
+func (ix *Index) Search(q Query) []Doc {
+	ix.Lock()
+	defer ix.Unlock()
+	var candidates []int
+	terms := Tokenize(q.Text)
+	if len(terms) == 0 {
+		candidates = make([]int, len(ix.docs))
+		for i := range candidates {
+			candidates[i] = i
+		}
+	}
+	for i, term := range terms {
+		postings := ix.withPrefix(term)
+		if i == 0 {
+			candidates = postings
+		} else {
+			candidates = intersect(candidates, postings)
+		}
+	}
+	results := []Doc{}
+	for _, position := range candidates {
+		if doc := ix.docs[position]; q.matches(doc) {
+			results = append(results, doc)
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Created > results[j].Created
+	})
+	if q.Limit > 0 && len(results) > q.Limit {
+		results = results[:q.Limit]
+	}
+	return results
+}
+
+// withPrefix returns the ascending positions of the docs containing any term
+// beginning with the prefix. The caller must hold the write lock.
+func (ix *Index) withPrefix(prefix string) []int {
+	if ix.terms == nil {
+		ix.terms = make([]string, 0, len(ix.postings))
+		for term := range ix.postings {
+			ix.terms = append(ix.terms, term)
+		}
+		sort.Strings(ix.terms)
+	}
+	found := make(map[int]struct{})
+	for i := sort.SearchStrings(ix.terms, prefix); i < len(ix.terms) && strings.HasPrefix(ix.terms[i], prefix); i++ {
+		for _, position := range ix.postings[ix.terms[i]] {
+			found[position] = struct{}{}
+		}
+	}
+	positions := make([]int, 0, len(found))
+	for position := range found {
+		positions = append(positions, position)
+	}
+	sort.Ints(positions)
+	return positions
+}
+
+// intersect returns the positions present in both ascending slices.
+func intersect(a, b []int) []int {
+	out := []int{}
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	return out
+}
@@ -0,0 +1,224 @@
+package searchindex
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	forest "git.sr.ht/~whereswaldon/forest-go"
+	"git.sr.ht/~whereswaldon/forest-go/store"
+	"git.sr.ht/~whereswaldon/forest-go/testutil"
+)
+
+// grove holds a community and a store that can look up its nodes
+type grove struct {
+	identity  *forest.Identity
+	builder   *forest.Builder
+	community *forest.Community
+	store     *store.MemoryStore
+}
+
+func newGrove(t *testing.T) *grove {
+	identity, signer, community := testutil.MakeCommunityOrSkip(t)
+	g := &grove{
+		identity:  identity,
+		builder:   forest.As(identity, signer),
+		community: community,
+		store:     store.NewMemoryStore(),
+	}
+	for _, node := range []forest.Node{identity, community} {
+		if err := g.store.Add(node); err != nil {
+			t.Fatalf("failed storing node: %v", err)
+		}
+	}
+	return g
+}
+
+// reply creates a reply in the community. Replies are created at least a
+// millisecond apart so that they are ordered.
+func (g *grove) reply(t *testing.T, content string) *forest.Reply {
+	time.Sleep(2 * time.Millisecond)
+	reply, err := g.builder.NewReply(g.community, content, []byte{})
+	if err != nil {
+		t.Fatalf("failed creating reply: %v", err)
+	}
+	return reply
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "searchindex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func ids(docs []Doc) []string {
+	out := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		out = append(out, doc.ID)
+	}
+	return out
+}
+
+func TestTokenize(t *testing.T) {
+	terms := Tokenize("Hello, hello WORLD! it's 2020")
+	expected := []string{"hello", "world", "it", "s", "2020"}
+	if !reflect.DeepEqual(terms, expected) {
+		t.Errorf("expected %v, got %v", expected, terms)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	g := newGrove(t)
+	ix, err := Open(dir)
+	if err != nil {
+		t.Fatalf("failed opening index: %v", err)
+	}
+	defer ix.Close()
+	first := g.reply(t, "the quick brown fox")
+	second := g.reply(t, "a quiet brown dog")
+	for _, reply := range []*forest.Reply{first, second} {
+		if err := ix.Add(reply, g.store); err != nil {
+			t.Fatalf("failed adding reply: %v", err)
+		}
+	}
+	authorName := string(g.identity.Name.Blob)
+	for _, test := range []struct {
+		query    Query
+		expected []*forest.Reply
+	}{
+		{Query{Text: "fox"}, []*forest.Reply{first}},
+		{Query{Text: "qui"}, []*forest.Reply{second, first}},
+		{Query{Text: "brown qui"}, []*forest.Reply{second, first}},
+		{Query{Text: "brown dog"}, []*forest.Reply{second}},
+		{Query{Text: "cat"}, nil},
+		{Query{Text: "brown", Author: authorName}, []*forest.Reply{second, first}},
+		{Query{Text: "brown", Author: "someone else"}, nil},
+		{Query{Text: "brown", Community: g.community.ID().String()}, []*forest.Reply{second, first}},
+		{Query{Text: "brown", Limit: 1}, []*forest.Reply{second}},
+	} {
+		expected := make([]string, 0, len(test.expected))
+		for _, reply := range test.expected {
+			expected = append(expected, reply.ID().String())
+		}
+		results := ids(ix.Search(test.query))
+		if !reflect.DeepEqual(results, expected) {
+			t.Errorf("expected %+v to find %v, got %v", test.query, expected, results)
+		}
+	}
+}
+
+func TestReopen(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	g := newGrove(t)
+	ix, err := Open(dir)
+	if err != nil {
+		t.Fatalf("failed opening index: %v", err)
+	}
+	compacted := g.reply(t, "compacted")
+	if err := ix.Add(compacted, g.store); err != nil {
+		t.Fatalf("failed adding reply: %v", err)
+	}
+	if err := ix.Compact(); err != nil {
+		t.Fatalf("failed compacting: %v", err)
+	}
+	journaled := g.reply(t, "journaled")
+	if err := ix.Add(journaled, g.store); err != nil {
+		t.Fatalf("failed adding reply: %v", err)
+	}
+	// leave a partial entry like a crash would
+	if _, err := ix.journal.Write([]byte(`{"ID":"partial`)); err != nil {
+		t.Fatal(err)
+	}
+	ix.journal.Close()
+	ix.unlock()
+
+	ix, err = Open(dir)
+	if err != nil {
+		t.Fatalf("failed reopening index: %v", err)
+	}
+	defer ix.Close()
+	if ix.ReadOnly {
+		t.Errorf("expected the index to be writable once its lock was released")
+	}
+	for _, reply := range []*forest.Reply{compacted, journaled} {
+		if !ix.Has(reply.ID().String()) {
+			t.Errorf("expected %q to be indexed after reopening", reply.Content.Blob)
+		}
+	}
+	if ix.Len() != 2 {
+		t.Errorf("expected 2 replies after reopening, got %d", ix.Len())
+	}
+}
+
+func TestReadOnlyWhileLocked(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	g := newGrove(t)
+	writer, err := Open(dir)
+	if err != nil {
+		t.Fatalf("failed opening index: %v", err)
+	}
+	shared := g.reply(t, "shared")
+	if err := writer.Add(shared, g.store); err != nil {
+		t.Fatalf("failed adding reply: %v", err)
+	}
+	journal := filepath.Join(dir, journalName)
+	before, err := ioutil.ReadFile(journal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := Open(dir)
+	if err != nil {
+		t.Fatalf("failed opening locked index: %v", err)
+	}
+	if !reader.ReadOnly {
+		t.Fatalf("expected an index locked by another writer to be read-only")
+	}
+	if !reader.Has(shared.ID().String()) {
+		t.Errorf("expected the read-only index to load the journal")
+	}
+	private := g.reply(t, "private")
+	if err := reader.Add(private, g.store); err != nil {
+		t.Fatalf("failed adding reply to read-only index: %v", err)
+	}
+	if len(reader.Search(Query{Text: "private"})) != 1 {
+		t.Errorf("expected the read-only index to search replies added to it")
+	}
+	if err := reader.Close(); err != nil {
+		t.Fatalf("failed closing read-only index: %v", err)
+	}
+	after, err := ioutil.ReadFile(journal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(before) {
+		t.Errorf("expected the read-only index to leave the journal alone")
+	}
+	if _, err := os.Stat(filepath.Join(dir, snapshotName)); !os.IsNotExist(err) {
+		t.Errorf("expected the read-only index not to write a snapshot")
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatalf("failed closing index: %v", err)
+	}
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatalf("failed reopening index: %v", err)
+	}
+	defer reopened.Close()
+	if reopened.ReadOnly {
+		t.Errorf("expected the index to be writable once its writer closed")
+	}
+	if !reopened.Has(shared.ID().String()) || reopened.Has(private.ID().String()) {
+		t.Errorf("expected only the writer's replies to be saved")
+	}
+}
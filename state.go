@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"git.sr.ht/~whereswaldon/wisteria/atomicfile"
+)
+
+// State holds choices made within the TUI that persist across restarts.
+// Unlike the Config, it is rewritten whenever one of those choices changes.
+type State struct {
+	// Community is the ID of the community that the history is restricted
+	// to, or empty if every community is shown
+	Community string
+	// Followed holds the IDs of the roots of the conversations that the user
+	// follows
+	Followed []string `json:",omitempty"`
+
+	path string
+}
+
+// LoadState loads the State saved at the given path. If nothing has been saved
+// there yet, the zero State is returned.
+func LoadState(path string) (*State, error) {
+	s := &State{path: path}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("failed reading state: %w", err)
+	}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("failed parsing state in %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Update reloads the State from its path, applies the change, and saves the
+// result if the change reports that it changed anything. Reloading keeps the
+// changes that other processes, like `wisteria new-community`, saved since
+// the State was loaded. The State takes on the reloaded values.
+func (s *State) Update(change func(*State) bool) error {
+	current, err := LoadState(s.path)
+	if err != nil {
+		return err
+	}
+	if change(current) {
+		if err := current.Save(); err != nil {
+			return err
+		}
+	}
+	*s = *current
+	return nil
+}
+
+// Save writes the State to the path that it was loaded from.
+func (s *State) Save() error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed encoding state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0770); err != nil {
+		return fmt.Errorf("failed creating state directory: %w", err)
+	}
+	if err := atomicfile.WriteFile(s.path, b, 0660); err != nil {
+		return fmt.Errorf("failed saving state: %w", err)
+	}
+	return nil
+}
+
+// IsFollowed reports whether the conversation with the given root ID is followed.
+func (s *State) IsFollowed(rootID string) bool {
+	for _, id := range s.Followed {
+		if id == rootID {
+			return true
+		}
+	}
+	return false
+}
+
+// SetFollowed follows or unfollows the conversation with the given root ID,
+// reporting whether that changed anything.
+func (s *State) SetFollowed(rootID string, follow bool) bool {
+	for i, id := range s.Followed {
+		if id == rootID {
+			if !follow {
+				s.Followed = append(s.Followed[:i], s.Followed[i+1:]...)
+			}
+			return !follow
+		}
+	}
+	if follow {
+		s.Followed = append(s.Followed, rootID)
+	}
+	return follow
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	forest "git.sr.ht/~whereswaldon/forest-go"
+	"git.sr.ht/~whereswaldon/forest-go/fields"
+	"git.sr.ht/~whereswaldon/wisteria/atomicfile"
+)
+
+// readMarkerSaveDelay is how long ReadMarkers waits after a change before
+// writing itself to disk, so that moving the cursor quickly over many
+// messages results in a single write.
+const readMarkerSaveDelay = 2 * time.Second
+
+// ReadMarkers records which replies a particular identity has read. Every
+// reply created before ReadBefore counts as read, as do the replies listed
+// individually and the identity's own replies.
+type ReadMarkers struct {
+	sync.Mutex
+	// Path is the file that the markers are persisted in
+	Path string
+	// ReadBefore is the creation time before which every reply counts as read
+	ReadBefore fields.Timestamp
+	read       map[string]struct{}
+	// self is the string form of the ID of the identity doing the reading
+	self      string
+	saveTimer *time.Timer
+}
+
+// readMarkerFile is the on-disk representation of ReadMarkers
+type readMarkerFile struct {
+	// ReadBefore is a number because the JSON form of fields.Timestamp cannot
+	// be decoded
+	ReadBefore uint64
+	Read       []string
+}
+
+// LoadReadMarkers loads the read markers for the identity with the given ID
+// from the provided path. If there are no markers saved there yet, every
+// existing reply is considered read.
+func LoadReadMarkers(path, identityID string) (*ReadMarkers, error) {
+	r := &ReadMarkers{
+		Path: path,
+		read: make(map[string]struct{}),
+		self: identityID,
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed reading read markers: %w", err)
+		}
+		r.ReadBefore = fields.TimestampFrom(time.Now())
+		return r, nil
+	}
+	var saved readMarkerFile
+	if err := json.Unmarshal(b, &saved); err != nil {
+		return nil, fmt.Errorf("failed parsing read markers in %s: %w", path, err)
+	}
+	r.ReadBefore = fields.Timestamp(saved.ReadBefore)
+	for _, id := range saved.Read {
+		r.read[id] = struct{}{}
+	}
+	return r, nil
+}
+
+// IsRead returns whether the reply has been read.
+func (r *ReadMarkers) IsRead(reply *forest.Reply) bool {
+	if reply.Created < r.ReadBefore || reply.Author.String() == r.self {
+		return true
+	}
+	r.Lock()
+	defer r.Unlock()
+	_, read := r.read[reply.ID().String()]
+	return read
+}
+
+// MarkRead records that the reply has been read and schedules the markers to be
+// saved. It returns whether the reply was previously unread.
+func (r *ReadMarkers) MarkRead(reply *forest.Reply) bool {
+	if r.IsRead(reply) {
+		return false
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.read[reply.ID().String()] = struct{}{}
+	if r.saveTimer == nil {
+		r.saveTimer = time.AfterFunc(readMarkerSaveDelay, func() {
+			if err := r.Save(); err != nil {
+				log.Printf("Failed saving read markers: %v", err)
+			}
+		})
+	}
+	return true
+}
+
+// Save writes the markers to their Path.
+func (r *ReadMarkers) Save() error {
+	r.Lock()
+	if r.saveTimer != nil {
+		r.saveTimer.Stop()
+		r.saveTimer = nil
+	}
+	saved := readMarkerFile{
+		ReadBefore: uint64(r.ReadBefore),
+		Read:       make([]string, 0, len(r.read)),
+	}
+	for id := range r.read {
+		saved.Read = append(saved.Read, id)
+	}
+	r.Unlock()
+	sort.Strings(saved.Read)
+	b, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed encoding read markers: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(r.Path), 0770); err != nil {
+		return fmt.Errorf("failed creating read marker directory: %w", err)
+	}
+	if err := atomicfile.WriteFile(r.Path, b, 0660); err != nil {
+		return fmt.Errorf("failed saving read markers: %w", err)
+	}
+	return nil
+}
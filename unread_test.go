@@ -0,0 +1,58 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	forest "git.sr.ht/~whereswaldon/forest-go"
+	"git.sr.ht/~whereswaldon/forest-go/testutil"
+)
+
+func TestReadMarkersSaveAndLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wisteria")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "read.json")
+	identity, signer, community := testutil.MakeCommunityOrSkip(t)
+	other, _ := testutil.MakeIdentityOrSkip(t)
+
+	markers, err := LoadReadMarkers(path, other.ID().String())
+	if err != nil {
+		t.Fatalf("failed loading missing markers: %v", err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	builder := forest.As(identity, signer)
+	read, err := builder.NewReply(community, "read", []byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unread, err := builder.NewReply(community, "unread", []byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if markers.IsRead(read) {
+		t.Fatalf("expected a new reply to be unread")
+	}
+	if !markers.MarkRead(read) || markers.MarkRead(read) {
+		t.Errorf("expected MarkRead to report only the first marking")
+	}
+	if err := markers.Save(); err != nil {
+		t.Fatalf("failed saving markers: %v", err)
+	}
+
+	loaded, err := LoadReadMarkers(path, other.ID().String())
+	if err != nil {
+		t.Fatalf("failed loading saved markers: %v", err)
+	}
+	if loaded.ReadBefore != markers.ReadBefore {
+		t.Errorf("expected ReadBefore %d, got %d", markers.ReadBefore, loaded.ReadBefore)
+	}
+	if !loaded.IsRead(read) || loaded.IsRead(unread) {
+		t.Errorf("expected only the marked reply to be read after loading")
+	}
+}
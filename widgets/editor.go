@@ -1,16 +1,25 @@
 package widgets
 
 import (
+	"strings"
+	"unicode"
+
 	"github.com/gdamore/tcell"
 	"github.com/gdamore/tcell/views"
-	"github.com/mattn/go-runewidth"
 )
 
-// Editor implements a simple text editor as a widget. It emits
-// EventSendRequest when an edited message is ready to be sent.
+// maxEditorLines is the tallest that an Editor will grow. Content beyond
+// this height scrolls within the editor.
+const maxEditorLines = 10
+
+// Editor implements a simple multi-line text editor as a widget. It emits
+// EventEditFinished when an edited message is ready to be sent, or when
+// the user sets it aside as a draft.
 type Editor struct {
 	*views.TextArea
-	content string
+	content []rune
+	// cursor is the index within content before which text is inserted
+	cursor int
 }
 
 // NewEditor constructs an empty Editor()
@@ -27,55 +36,230 @@ func NewEditor() *Editor {
 func (e *Editor) HandleEvent(ev tcell.Event) bool {
 	switch event := ev.(type) {
 	case *tcell.EventKey:
+		alt := event.Modifiers()&tcell.ModAlt != 0
 		switch event.Key() {
 		case tcell.KeyEnter:
+			if alt {
+				e.TypeRune('\n')
+				return true
+			}
 			// don't provide an ID because we don't actually know the right one
 			// higher level logic should populate it.
-			e.PostEvent(NewEventEditFinished(0, e, e.content))
+			e.PostEvent(NewEventEditFinished(0, e, string(e.content)))
+			return true
+		case tcell.KeyEscape:
+			e.PostEvent(NewEventEditDrafted(0, e, string(e.content)))
+			return true
+		case tcell.KeyCtrlJ:
+			e.TypeRune('\n')
 			return true
-		case tcell.KeyBackspace:
-			fallthrough
-		case tcell.KeyBackspace2:
+		case tcell.KeyBackspace, tcell.KeyBackspace2:
+			if alt {
+				e.deleteTo(e.wordStart())
+				return true
+			}
 			e.UntypeRune()
 			return true
+		case tcell.KeyCtrlW:
+			e.deleteTo(e.wordStart())
+			return true
+		case tcell.KeyDelete, tcell.KeyCtrlD:
+			e.deleteTo(e.cursor + 1)
+			return true
+		case tcell.KeyLeft, tcell.KeyCtrlB:
+			e.moveTo(e.cursor - 1)
+			return true
+		case tcell.KeyRight, tcell.KeyCtrlF:
+			e.moveTo(e.cursor + 1)
+			return true
+		case tcell.KeyUp, tcell.KeyCtrlP:
+			e.moveTo(e.lineAbove())
+			return true
+		case tcell.KeyDown, tcell.KeyCtrlN:
+			e.moveTo(e.lineBelow())
+			return true
+		case tcell.KeyHome, tcell.KeyCtrlA:
+			e.moveTo(e.lineStart(e.cursor))
+			return true
+		case tcell.KeyEnd, tcell.KeyCtrlE:
+			e.moveTo(e.lineEnd(e.cursor))
+			return true
 		case tcell.KeyRune:
+			if alt {
+				switch event.Rune() {
+				case 'b':
+					e.moveTo(e.wordStart())
+					return true
+				case 'f':
+					e.moveTo(e.wordEnd())
+					return true
+				case 'd':
+					e.deleteTo(e.wordEnd())
+					return true
+				}
+				return false
+			}
 			e.TypeRune(event.Rune())
 			return true
-		default:
-			// suppress cursor manipulation since we can't use it
-			//			return e.TextArea.HandleEvent(ev)
 		}
 	}
 	return false
 }
 
-// Type rune adds the provided rune to the content of the editor.
+// TypeRune inserts the provided rune into the content of the editor at the
+// cursor.
 func (e *Editor) TypeRune(keypress rune) {
-	e.content += string(keypress)
+	e.content = append(e.content, 0)
+	copy(e.content[e.cursor+1:], e.content[e.cursor:])
+	e.content[e.cursor] = keypress
+	e.cursor++
 	e.UpdateContent()
 }
 
-// Untype rune deletes the last rune in the editor.
+// UntypeRune deletes the rune before the cursor.
 func (e *Editor) UntypeRune() {
-	if len(e.content) < 1 {
+	e.deleteTo(e.cursor - 1)
+}
+
+// deleteTo removes the content between the cursor and the given position,
+// which may be on either side of the cursor.
+func (e *Editor) deleteTo(position int) {
+	position = e.clamp(position)
+	start, end := e.cursor, position
+	if end < start {
+		start, end = end, start
+	}
+	if start == end {
 		return
 	}
-	asRunes := []rune(e.content)
-	e.content = string(asRunes[:len(asRunes)-1])
+	e.content = append(e.content[:start], e.content[end:]...)
+	e.cursor = start
 	e.UpdateContent()
 }
 
+// moveTo places the cursor at the given position within the content.
+func (e *Editor) moveTo(position int) {
+	e.cursor = e.clamp(position)
+	e.UpdateContent()
+}
+
+// clamp constrains the position to lie within the content.
+func (e *Editor) clamp(position int) int {
+	if position < 0 {
+		return 0
+	}
+	if position > len(e.content) {
+		return len(e.content)
+	}
+	return position
+}
+
+// wordStart returns the position of the start of the word before the cursor.
+func (e *Editor) wordStart() int {
+	i := e.cursor
+	for i > 0 && unicode.IsSpace(e.content[i-1]) {
+		i--
+	}
+	for i > 0 && !unicode.IsSpace(e.content[i-1]) {
+		i--
+	}
+	return i
+}
+
+// wordEnd returns the position of the end of the word after the cursor.
+func (e *Editor) wordEnd() int {
+	i := e.cursor
+	for i < len(e.content) && unicode.IsSpace(e.content[i]) {
+		i++
+	}
+	for i < len(e.content) && !unicode.IsSpace(e.content[i]) {
+		i++
+	}
+	return i
+}
+
+// lineStart returns the position of the start of the line containing position.
+func (e *Editor) lineStart(position int) int {
+	for position > 0 && e.content[position-1] != '\n' {
+		position--
+	}
+	return position
+}
+
+// lineEnd returns the position of the end of the line containing position.
+func (e *Editor) lineEnd(position int) int {
+	for position < len(e.content) && e.content[position] != '\n' {
+		position++
+	}
+	return position
+}
+
+// lineAbove returns the position in the previous line that is in the same
+// column as the cursor, or as close as that line allows.
+func (e *Editor) lineAbove() int {
+	start := e.lineStart(e.cursor)
+	if start == 0 {
+		return e.cursor
+	}
+	column := e.cursor - start
+	above := e.lineStart(start - 1)
+	if above+column > start-1 {
+		return start - 1
+	}
+	return above + column
+}
+
+// lineBelow returns the position in the next line that is in the same
+// column as the cursor, or as close as that line allows.
+func (e *Editor) lineBelow() int {
+	end := e.lineEnd(e.cursor)
+	if end == len(e.content) {
+		return e.cursor
+	}
+	column := e.cursor - e.lineStart(e.cursor)
+	below := end + 1
+	if belowEnd := e.lineEnd(below); below+column > belowEnd {
+		return belowEnd
+	}
+	return below + column
+}
+
 // UpdateContent synchronizes the internal editor state and the visible
 // editor state.
 func (e *Editor) UpdateContent() {
-	width := runewidth.StringWidth(e.content)
-	// add empty space so that the cursor has somewhere to be
-	e.TextArea.SetContent(e.content + " ")
-	e.TextArea.SetCursorX(width)
+	lines := strings.Split(string(e.content), "\n")
+	for i := range lines {
+		// add empty space so that the cursor has somewhere to be
+		lines[i] += " "
+	}
+	e.TextArea.SetLines(lines)
+	column := e.cursor - e.lineStart(e.cursor)
+	row := strings.Count(string(e.content[:e.cursor]), "\n")
+	e.TextArea.SetCursor(column, row)
+	e.TextArea.MakeCursorVisible()
+}
+
+// Size returns the preferred size of the editor, which grows with its content
+// up to maxEditorLines.
+func (e *Editor) Size() (int, int) {
+	width, _ := e.TextArea.Size()
+	height := strings.Count(string(e.content), "\n") + 1
+	if height > maxEditorLines {
+		height = maxEditorLines
+	}
+	return width, height
+}
+
+// SetText replaces the content of the editor, placing the cursor at the end.
+func (e *Editor) SetText(text string) {
+	e.content = []rune(text)
+	e.cursor = len(e.content)
+	e.UpdateContent()
 }
 
 // Clear erases the content of the editor.
 func (e *Editor) Clear() {
-	e.content = ""
+	e.content = nil
+	e.cursor = 0
 	e.UpdateContent()
 }
@@ -0,0 +1,114 @@
+package widgets
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell"
+)
+
+// editorWith creates an Editor holding the text, with the cursor where the
+// text contains a '|'.
+func editorWith(text string) *Editor {
+	e := NewEditor()
+	e.SetText(strings.Replace(text, "|", "", 1))
+	e.moveTo(strings.Index(text, "|"))
+	return e
+}
+
+// state describes the content of the editor with a '|' at the cursor.
+func (e *Editor) state() string {
+	return string(e.content[:e.cursor]) + "|" + string(e.content[e.cursor:])
+}
+
+// key creates a keypress of a special key.
+func key(k tcell.Key) *tcell.EventKey {
+	return tcell.NewEventKey(k, 0, tcell.ModNone)
+}
+
+// alt creates a keypress of a rune with the Alt modifier.
+func alt(r rune) *tcell.EventKey {
+	return tcell.NewEventKey(tcell.KeyRune, r, tcell.ModAlt)
+}
+
+// typed creates a keypress of a rune.
+func typed(r rune) *tcell.EventKey {
+	return tcell.NewEventKey(tcell.KeyRune, r, tcell.ModNone)
+}
+
+func TestEditorKeys(t *testing.T) {
+	for _, test := range []struct {
+		name          string
+		before, after string
+		keys          []*tcell.EventKey
+	}{
+		{"type in the middle", "ab|d", "abc|d", []*tcell.EventKey{typed('c')}},
+		{"newline", "ab|cd", "ab\n|cd", []*tcell.EventKey{key(tcell.KeyCtrlJ)}},
+		{"backspace", "ab|c", "a|c", []*tcell.EventKey{key(tcell.KeyBackspace2)}},
+		{"backspace at start", "|abc", "|abc", []*tcell.EventKey{key(tcell.KeyBackspace)}},
+		{"delete", "a|bc", "a|c", []*tcell.EventKey{key(tcell.KeyDelete)}},
+		{"delete at end", "abc|", "abc|", []*tcell.EventKey{key(tcell.KeyCtrlD)}},
+		{"left and right", "ab|c", "abc|", []*tcell.EventKey{key(tcell.KeyLeft), key(tcell.KeyRight), key(tcell.KeyRight), key(tcell.KeyRight)}},
+		{"left at start", "|abc", "|abc", []*tcell.EventKey{key(tcell.KeyCtrlB)}},
+		{"delete word", "one two  |three", "one |three", []*tcell.EventKey{key(tcell.KeyCtrlW)}},
+		{"delete word at start", "|one", "|one", []*tcell.EventKey{key(tcell.KeyCtrlW)}},
+		{"alt backspace", "one tw|o", "one |o", []*tcell.EventKey{tcell.NewEventKey(tcell.KeyBackspace2, 0, tcell.ModAlt)}},
+		{"delete word forward", "one| two three", "one| three", []*tcell.EventKey{alt('d')}},
+		{"word back", "one two|", "one |two", []*tcell.EventKey{alt('b')}},
+		{"word back across lines", "one\n  |two", "|one\n  two", []*tcell.EventKey{alt('b')}},
+		{"word forward", "|one two", "one two|", []*tcell.EventKey{alt('f'), alt('f'), alt('f')}},
+		{"home and end", "one\ntw|o\nthree", "one\n|two\nthree", []*tcell.EventKey{key(tcell.KeyEnd), key(tcell.KeyHome)}},
+		{"end of last line", "one\nt|wo", "one\ntwo|", []*tcell.EventKey{key(tcell.KeyCtrlE)}},
+		{"up keeps column", "abc\nde|f", "ab|c\ndef", []*tcell.EventKey{key(tcell.KeyUp)}},
+		{"up clamps to shorter line", "a\nbcd|", "a|\nbcd", []*tcell.EventKey{key(tcell.KeyUp)}},
+		{"up clamps to empty line", "\nbcd|", "|\nbcd", []*tcell.EventKey{key(tcell.KeyCtrlP)}},
+		{"up on first line", "ab|c\ndef", "ab|c\ndef", []*tcell.EventKey{key(tcell.KeyUp)}},
+		{"down keeps column", "a|bc\ndef", "abc\nd|ef", []*tcell.EventKey{key(tcell.KeyDown)}},
+		{"down clamps to shorter line", "abc|\nd\nefg", "abc\nd|\nefg", []*tcell.EventKey{key(tcell.KeyDown)}},
+		{"down clamps to last empty line", "abc|\n", "abc\n|", []*tcell.EventKey{key(tcell.KeyCtrlN)}},
+		{"down on last line", "abc\nd|ef", "abc\nd|ef", []*tcell.EventKey{key(tcell.KeyDown)}},
+		{"each move clamps the column", "abc|\nd\nefg", "abc\nd\ne|fg", []*tcell.EventKey{key(tcell.KeyDown), key(tcell.KeyDown), key(tcell.KeyUp), key(tcell.KeyDown)}},
+	} {
+		e := editorWith(test.before)
+		for _, ev := range test.keys {
+			if !e.HandleEvent(ev) {
+				t.Errorf("%s: key %s was not handled", test.name, ev.Name())
+			}
+		}
+		if state := e.state(); state != test.after {
+			t.Errorf("%s: expected %q, got %q", test.name, test.after, state)
+		}
+	}
+}
+
+// finished records the edits that an editor finishes.
+type finished []EventEditFinished
+
+func (f *finished) HandleEvent(ev tcell.Event) bool {
+	if event, ok := ev.(EventEditFinished); ok {
+		*f = append(*f, event)
+	}
+	return true
+}
+
+func TestEditorFinish(t *testing.T) {
+	e := editorWith("one|")
+	var events finished
+	e.Watch(&events)
+	e.HandleEvent(tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModAlt))
+	e.HandleEvent(typed('2'))
+	e.HandleEvent(key(tcell.KeyEnter))
+	e.HandleEvent(key(tcell.KeyEscape))
+	if len(events) != 2 {
+		t.Fatalf("expected 2 finished edits, got %d", len(events))
+	}
+	if events[0].Content != "one\n2" || events[0].Draft {
+		t.Errorf("expected Enter to send %q, got %q (draft %v)", "one\n2", events[0].Content, events[0].Draft)
+	}
+	if !events[1].Draft {
+		t.Errorf("expected Escape to keep a draft")
+	}
+	if _, height := e.Size(); height != 2 {
+		t.Errorf("expected the editor to grow to 2 lines, got %d", height)
+	}
+}
@@ -21,13 +21,17 @@ type EphemeralEditor struct {
 	views.WidgetWatchers
 }
 
+// replyPrompt is displayed above the editor unless an EventEditRequest provides
+// a different prompt
+const replyPrompt = "Type your reply below; Enter to send; Alt-Enter for a new line; Esc to save as draft; Send empty message to cancel"
+
 // NewEphemeralEditor creates a new layout with the given view as the
 // primary content.
 func NewEphemeralEditor(primary views.Widget) *EphemeralEditor {
 	separator := views.NewTextBar()
 	style := tcell.StyleDefault.Reverse(true)
 	separator.SetStyle(style)
-	separator.SetLeft("Type your reply below; Enter to send; Send empty message to cancel", style)
+	separator.SetLeft(replyPrompt, style)
 	e := &EphemeralEditor{
 		PrimaryContent: primary,
 		Editor:         NewEditor(),
@@ -85,19 +89,24 @@ func (e *EphemeralEditor) ClearRequestor() {
 func (e *EphemeralEditor) HandleEvent(ev tcell.Event) bool {
 	switch event := ev.(type) {
 	case EventEditRequest:
+		prompt := event.Prompt
+		if prompt == "" {
+			prompt = replyPrompt
+		}
+		e.Separator.(*views.TextBar).SetLeft(prompt, tcell.StyleDefault.Reverse(true))
 		e.ShowEditor()
+		e.Editor.(*Editor).SetText(event.Content)
 		e.SetRequestor(event)
 		return true
 	case EventEditFinished:
 		// pass the EventEditFinished to the widget that created the
-		// EventEditRequest with the ID field populated
+		// EventEditRequest with the ID field populated. Clean up first so
+		// that the requestor can immediately request another edit.
 		event.ID = e.RequestID
-		defer func() {
-			// clean up after handling event
-			e.HideEditor()
-			e.ClearRequestor()
-		}()
-		return e.Requestor.HandleEvent(event)
+		requestor := e.Requestor
+		e.HideEditor()
+		e.ClearRequestor()
+		return requestor.HandleEvent(event)
 	case views.EventWidget:
 		e.PostEvent(event)
 	case *tcell.EventMouse:
@@ -59,6 +59,9 @@ func NewEventReplySelected(widget views.Widget, selected *forest.Reply, author *
 type EventEditRequest struct {
 	ID      int
 	Content string
+	// Prompt is displayed above the editor. A prompt for writing a reply is
+	// displayed if it is empty.
+	Prompt string
 	BasicEvent
 }
 
@@ -71,6 +74,14 @@ func NewEventEditRequest(id int, widget views.Widget, content string) EventEditR
 	}
 }
 
+// NewEventPromptRequest creates a new request for a line of input from the user
+// that displays the given prompt instead of the prompt for writing a reply.
+func NewEventPromptRequest(id int, widget views.Widget, prompt string) EventEditRequest {
+	event := NewEventEditRequest(id, widget, "")
+	event.Prompt = prompt
+	return event
+}
+
 var _ views.EventWidget = EventEditRequest{}
 
 // EventEditFinished indicates that an EventEditFinished has been processed by
@@ -79,6 +90,9 @@ var _ views.EventWidget = EventEditRequest{}
 type EventEditFinished struct {
 	ID      int
 	Content string
+	// Draft indicates that the content should be kept as a draft instead
+	// of being sent
+	Draft bool
 	BasicEvent
 }
 
@@ -92,4 +106,139 @@ func NewEventEditFinished(id int, widget views.Widget, content string) EventEdit
 	}
 }
 
+// NewEventEditDrafted creates a finished event for an edit that the user set
+// aside as a draft rather than sending.
+func NewEventEditDrafted(id int, widget views.Widget, content string) EventEditFinished {
+	event := NewEventEditFinished(id, widget, content)
+	event.Draft = true
+	return event
+}
+
 var _ views.EventWidget = EventEditFinished{}
+
+// EventShowContent requests that a Switcher display its content widget.
+// It fulfills views.EventWidget.
+type EventShowContent struct {
+	BasicEvent
+}
+
+// NewEventShowContent creates a new request to show the content widget.
+func NewEventShowContent(widget views.Widget) EventShowContent {
+	return EventShowContent{
+		BasicEvent: NewBasicEvent(widget),
+	}
+}
+
+var _ views.EventWidget = EventShowContent{}
+
+// EventShowWidget requests that a Switcher display the given widget in place
+// of its content widget until EventShowContent is posted.
+// It fulfills views.EventWidget.
+type EventShowWidget struct {
+	BasicEvent
+	Shown views.Widget
+}
+
+// NewEventShowWidget creates a new request to show a widget.
+func NewEventShowWidget(widget, shown views.Widget) EventShowWidget {
+	return EventShowWidget{
+		BasicEvent: NewBasicEvent(widget),
+		Shown:      shown,
+	}
+}
+
+var _ views.EventWidget = EventShowWidget{}
+
+// EventUnreadCount reports how many unread messages there are.
+// It fulfills views.EventWidget.
+type EventUnreadCount struct {
+	Count int
+	BasicEvent
+}
+
+// NewEventUnreadCount creates a new report of the number of unread messages.
+func NewEventUnreadCount(widget views.Widget, count int) EventUnreadCount {
+	return EventUnreadCount{
+		Count:      count,
+		BasicEvent: NewBasicEvent(widget),
+	}
+}
+
+var _ views.EventWidget = EventUnreadCount{}
+
+// EventCommunityScope reports which community the history is restricted to.
+// It fulfills views.EventWidget.
+type EventCommunityScope struct {
+	// Community is the community that the history is restricted to, or nil if
+	// every community is shown
+	Community *forest.Community
+	BasicEvent
+}
+
+// NewEventCommunityScope creates a new report of the community that the history
+// is restricted to.
+func NewEventCommunityScope(widget views.Widget, community *forest.Community) EventCommunityScope {
+	return EventCommunityScope{
+		Community:  community,
+		BasicEvent: NewBasicEvent(widget),
+	}
+}
+
+var _ views.EventWidget = EventCommunityScope{}
+
+// EventDoNotDisturb reports whether notifications are suppressed.
+// It fulfills views.EventWidget.
+type EventDoNotDisturb struct {
+	Enabled bool
+	BasicEvent
+}
+
+// NewEventDoNotDisturb creates a new report of whether notifications are
+// suppressed.
+func NewEventDoNotDisturb(widget views.Widget, enabled bool) EventDoNotDisturb {
+	return EventDoNotDisturb{
+		Enabled:    enabled,
+		BasicEvent: NewBasicEvent(widget),
+	}
+}
+
+var _ views.EventWidget = EventDoNotDisturb{}
+
+// EventIdentity reports which identity new messages are posted as.
+// It fulfills views.EventWidget.
+type EventIdentity struct {
+	Identity *forest.Identity
+	BasicEvent
+}
+
+// NewEventIdentity creates a new report of the identity in use.
+func NewEventIdentity(widget views.Widget, identity *forest.Identity) EventIdentity {
+	return EventIdentity{
+		Identity:   identity,
+		BasicEvent: NewBasicEvent(widget),
+	}
+}
+
+var _ views.EventWidget = EventIdentity{}
+
+// EventRelays summarizes the states of the relays that wisteria is connected
+// or connecting to. It fulfills views.EventWidget.
+type EventRelays struct {
+	// Connected, Reconnecting, and Failed count the relays in each state,
+	// and Total counts every relay that is connected or connecting
+	Connected, Reconnecting, Failed, Total int
+	BasicEvent
+}
+
+// NewEventRelays creates a new summary of the relay states.
+func NewEventRelays(widget views.Widget, connected, reconnecting, failed, total int) EventRelays {
+	return EventRelays{
+		Connected:    connected,
+		Reconnecting: reconnecting,
+		Failed:       failed,
+		Total:        total,
+		BasicEvent:   NewBasicEvent(widget),
+	}
+}
+
+var _ views.EventWidget = EventRelays{}
@@ -0,0 +1,67 @@
+package widgets
+
+import (
+	"fmt"
+	"strings"
+
+	"git.sr.ht/~whereswaldon/wisteria/keymap"
+	"github.com/gdamore/tcell"
+)
+
+// Help lists every action known to a Keymap along with the keys currently
+// bound to it and a description of what it does. Esc or q dismisses it.
+type Help struct {
+	*List
+	Keys *keymap.Keymap
+}
+
+// NewHelp creates a Help widget describing the given key bindings.
+func NewHelp(keys *keymap.Keymap) *Help {
+	h := &Help{
+		List: NewList(),
+		Keys: keys,
+	}
+	h.Refresh()
+	return h
+}
+
+// Refresh rebuilds the listing from the bindings in the Keymap.
+func (h *Help) Refresh() {
+	actions := h.Keys.Actions()
+	bound := make([]string, len(actions))
+	keyWidth, nameWidth := 0, 0
+	for i, action := range actions {
+		sequences := h.Keys.Keys(action.Name)
+		names := make([]string, len(sequences))
+		for j, seq := range sequences {
+			names[j] = seq.String()
+		}
+		bound[i] = strings.Join(names, ", ")
+		if bound[i] == "" {
+			bound[i] = "(unbound)"
+		}
+		if len(bound[i]) > keyWidth {
+			keyWidth = len(bound[i])
+		}
+		if len(action.Name) > nameWidth {
+			nameWidth = len(action.Name)
+		}
+	}
+	items := make([]string, 0, len(actions)+2)
+	items = append(items, "Key bindings (Esc to close)", "")
+	for i, action := range actions {
+		items = append(items, fmt.Sprintf("%-*s  %-*s  %s", keyWidth, bound[i], nameWidth, action.Name, action.Description))
+	}
+	h.SetItems(items)
+}
+
+// HandleEvent dismisses the Help on Esc or q and scrolls it otherwise.
+func (h *Help) HandleEvent(ev tcell.Event) bool {
+	if event, ok := ev.(*tcell.EventKey); ok {
+		if event.Key() == tcell.KeyEscape || (event.Key() == tcell.KeyRune && event.Rune() == 'q') {
+			h.PostEvent(NewEventShowContent(h))
+			return true
+		}
+	}
+	return h.List.HandleEvent(ev)
+}
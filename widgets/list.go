@@ -0,0 +1,161 @@
+package widgets
+
+import (
+	"strings"
+
+	"github.com/gdamore/tcell"
+	"github.com/gdamore/tcell/views"
+)
+
+// listModel is a CellModel that displays items of one or more lines and
+// highlights the selected one.
+type listModel struct {
+	rows [][]rune
+	// itemOf holds the index of the item that each row belongs to
+	itemOf []int
+	// firstRow holds the index of the first row of each item
+	firstRow []int
+	width    int
+	selected int
+	style    tcell.Style
+}
+
+func (m *listModel) GetCell(x, y int) (rune, tcell.Style, []rune, int) {
+	if y < 0 || y >= len(m.rows) {
+		return 0, m.style, nil, 1
+	}
+	style := m.style
+	if m.itemOf[y] == m.selected {
+		style = style.Reverse(true)
+	}
+	if x < 0 || x >= len(m.rows[y]) {
+		// highlight the whole selected item
+		return ' ', style, nil, 1
+	}
+	return m.rows[y][x], style, nil, 1
+}
+
+func (m *listModel) GetBounds() (int, int) {
+	return m.width, len(m.rows)
+}
+
+func (m *listModel) limitCursor() {
+	if m.selected > len(m.firstRow)-1 {
+		m.selected = len(m.firstRow) - 1
+	}
+	if m.selected < 0 {
+		m.selected = 0
+	}
+}
+
+// SetCursor selects the item displayed in row y.
+func (m *listModel) SetCursor(x, y int) {
+	switch {
+	case len(m.rows) == 0:
+		m.selected = 0
+	case y < 0:
+		m.selected = 0
+	case y >= len(m.rows):
+		m.selected = len(m.firstRow) - 1
+	default:
+		m.selected = m.itemOf[y]
+	}
+}
+
+// MoveCursor moves the selection by y items.
+func (m *listModel) MoveCursor(x, y int) {
+	m.selected += y
+	m.limitCursor()
+}
+
+// GetCursor reports the cursor as enabled so that the CellView moves it, but
+// hidden since the whole selected item is highlighted instead.
+func (m *listModel) GetCursor() (int, int, bool, bool) {
+	if len(m.firstRow) == 0 {
+		return 0, 0, true, false
+	}
+	return 0, m.firstRow[m.selected], true, false
+}
+
+// List displays items of one or more lines of text and allows one of them
+// to be selected with the arrow or vi keys. Widgets that need to act on the selection can
+// embed a List and handle additional keys before delegating to it.
+type List struct {
+	*views.CellView
+	model *listModel
+}
+
+// NewList creates an empty List.
+func NewList() *List {
+	l := &List{
+		CellView: views.NewCellView(),
+		model:    &listModel{},
+	}
+	l.CellView.SetModel(l.model)
+	return l
+}
+
+// SetItems replaces the items in the list. Items containing newlines occupy
+// several rows. The selection keeps its position as long as that position is
+// still within the list.
+func (l *List) SetItems(items []string) {
+	m := l.model
+	m.rows = m.rows[:0]
+	m.itemOf = m.itemOf[:0]
+	m.firstRow = make([]int, len(items))
+	m.width = 0
+	for i, item := range items {
+		m.firstRow[i] = len(m.rows)
+		for _, line := range strings.Split(item, "\n") {
+			row := []rune(line)
+			m.rows = append(m.rows, row)
+			m.itemOf = append(m.itemOf, i)
+			if len(row) > m.width {
+				m.width = len(row)
+			}
+		}
+	}
+	m.limitCursor()
+	l.CellView.SetModel(m)
+}
+
+// Len returns the number of items in the list.
+func (l *List) Len() int {
+	return len(l.model.firstRow)
+}
+
+// Selected returns the index of the selected item, or -1 if the list is empty.
+func (l *List) Selected() int {
+	if len(l.model.firstRow) == 0 {
+		return -1
+	}
+	return l.model.selected
+}
+
+// Select moves the selection to the item at the given index.
+func (l *List) Select(index int) {
+	l.model.selected = index
+	l.model.limitCursor()
+	l.CellView.MakeCursorVisible()
+}
+
+// HandleEvent moves the selection in response to keypresses.
+func (l *List) HandleEvent(ev tcell.Event) bool {
+	if event, ok := ev.(*tcell.EventKey); ok && event.Key() == tcell.KeyRune {
+		switch event.Rune() {
+		case 'j':
+			l.Select(l.model.selected + 1)
+			return true
+		case 'k':
+			l.Select(l.model.selected - 1)
+			return true
+		case 'g':
+			l.Select(0)
+			return true
+		case 'G':
+			l.Select(l.Len() - 1)
+			return true
+		}
+	}
+	return l.CellView.HandleEvent(ev)
+}
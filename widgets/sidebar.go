@@ -0,0 +1,114 @@
+package widgets
+
+import (
+	"github.com/gdamore/tcell"
+	"github.com/gdamore/tcell/views"
+
+	"git.sr.ht/~whereswaldon/wisteria/keymap"
+)
+
+// Names of the actions performed by the Sidebar
+const (
+	ActionToggleSidebar = "toggle-sidebar"
+	ActionSwitchFocus   = "switch-focus"
+)
+
+// Sidebar is a layout that can display a side pane to the right of its main
+// content. Key events go to whichever of the two has focus, while mouse events
+// always go to the main content.
+type Sidebar struct {
+	Main, Side views.Widget
+	// Keys resolves keypresses into the actions performed by the Sidebar
+	Keys *keymap.Keymap
+	// SideVisible indicates that the side pane is displayed
+	SideVisible bool
+	// SideFocused indicates that the side pane receives key events
+	SideFocused bool
+	*views.BoxLayout
+	views.WidgetWatchers
+}
+
+// NewSidebar creates a Sidebar with the side pane hidden. The side pane should
+// report the width that it wants from its Size method. The keys must provide
+// bindings for ActionToggleSidebar and ActionSwitchFocus.
+func NewSidebar(main, side views.Widget, keys *keymap.Keymap) *Sidebar {
+	s := &Sidebar{
+		Main:      main,
+		Side:      side,
+		Keys:      keys,
+		BoxLayout: views.NewBoxLayout(views.Horizontal),
+	}
+	s.BoxLayout.Watch(s)
+	s.Main.Watch(s)
+	s.Side.Watch(s)
+	s.BoxLayout.AddWidget(s.Main, 1.0)
+	return s
+}
+
+// ShowSide displays the side pane and gives it focus.
+func (s *Sidebar) ShowSide() {
+	if !s.SideVisible {
+		s.BoxLayout.AddWidget(s.Side, 0)
+		s.SideVisible = true
+	}
+	s.SideFocused = true
+}
+
+// HideSide hides the side pane and returns focus to the main content.
+func (s *Sidebar) HideSide() {
+	if s.SideVisible {
+		s.BoxLayout.RemoveWidget(s.Side)
+		s.SideVisible = false
+	}
+	s.SideFocused = false
+}
+
+// ToggleSide shows and focuses the side pane if it is hidden or unfocused, and
+// hides it otherwise.
+func (s *Sidebar) ToggleSide() {
+	if s.SideVisible && s.SideFocused {
+		s.HideSide()
+		return
+	}
+	s.ShowSide()
+}
+
+// HandleEvent routes input to the focused pane and propagates events from
+// both panes upward. The side pane can return focus to the main content by
+// posting EventShowContent.
+func (s *Sidebar) HandleEvent(ev tcell.Event) bool {
+	switch event := ev.(type) {
+	case EventShowContent:
+		if event.Widget() == s.Side {
+			s.SideFocused = false
+			return true
+		}
+		s.PostEvent(event)
+	case views.EventWidget:
+		s.PostEvent(event)
+	case *tcell.EventMouse:
+		return s.Main.HandleEvent(ev)
+	case *tcell.EventKey:
+		focused := s.Main
+		if s.SideFocused {
+			focused = s.Side
+		}
+		if focused.HandleEvent(ev) {
+			return true
+		}
+		action, result := s.Keys.Match(event)
+		switch {
+		case result == keymap.Pending:
+			return true
+		case result == keymap.NoMatch:
+		case action == ActionToggleSidebar:
+			s.ToggleSide()
+			s.PostEventWidgetContent(s)
+			return true
+		case action == ActionSwitchFocus && s.SideVisible:
+			s.SideFocused = !s.SideFocused
+			return true
+		}
+	}
+	return false
+}
@@ -8,8 +8,11 @@ import (
 	"github.com/gdamore/tcell/views"
 )
 
+// StatusBar displays the identity in use and a summary of the relays along
+// with details of the selected message.
 type StatusBar struct {
 	views.SimpleStyledTextBar
+	identity, community, relays string
 }
 
 func NewStatusBar() *StatusBar {
@@ -21,11 +24,52 @@ func NewStatusBar() *StatusBar {
 func (s *StatusBar) HandleEvent(ev tcell.Event) bool {
 	switch event := ev.(type) {
 	case EventReplySelected:
-		s.SetLeft(fmt.Sprintf("%%SCommunity: %s", string(event.Community.Name.Blob)))
+		s.community = string(event.Community.Name.Blob)
+		s.updateLeft()
 		timestamp := event.Selected.Created.Time().Local()
 		s.SetCenter(fmt.Sprintf("%%SDepth: %d, Written: %s", event.Selected.Depth, timestamp.Format(time.Stamp)))
 		s.SetRight(fmt.Sprintf("%%SID: %s", event.Selected.ID().String()[:20]))
 		return true
+	case EventIdentity:
+		s.identity = string(event.Identity.Name.Blob)
+		s.updateLeft()
+		return true
+	case EventRelays:
+		s.relays = summarizeRelays(event)
+		s.updateLeft()
+		return true
 	}
 	return false
 }
+
+// updateLeft displays the identity in use, the community of the selected
+// message, and the relay summary.
+func (s *StatusBar) updateLeft() {
+	left := "%S"
+	if s.identity != "" {
+		left += fmt.Sprintf("As: %s ", escapeMarkup(s.identity))
+	}
+	if s.community != "" {
+		left += fmt.Sprintf("Community: %s ", escapeMarkup(s.community))
+	}
+	if s.relays != "" {
+		left += fmt.Sprintf("Relays: %s", s.relays)
+	}
+	s.SetLeft(left)
+}
+
+// summarizeRelays describes the relay states briefly, like
+// "2/3 connected, 1 failed".
+func summarizeRelays(event EventRelays) string {
+	if event.Total == 0 {
+		return "none"
+	}
+	summary := fmt.Sprintf("%d/%d connected", event.Connected, event.Total)
+	if event.Reconnecting > 0 {
+		summary += fmt.Sprintf(", %d reconnecting", event.Reconnecting)
+	}
+	if event.Failed > 0 {
+		summary += fmt.Sprintf(", %d failed", event.Failed)
+	}
+	return summary
+}
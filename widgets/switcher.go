@@ -4,9 +4,16 @@ import (
 	"github.com/gdamore/tcell"
 	"github.com/gdamore/tcell/views"
 
+	"git.sr.ht/~whereswaldon/wisteria/keymap"
 	wistTcell "git.sr.ht/~whereswaldon/wisteria/widgets/tcell"
 )
 
+// Names of the actions performed by the Switcher
+const (
+	ActionQuit      = "quit"
+	ActionToggleLog = "toggle-log"
+)
+
 // Switcher allows toggling a single widget between multiple underlying widgets
 // with only one widget visible at a time. Only the visible widget receives
 // events.
@@ -17,37 +24,68 @@ type Switcher struct {
 
 	Current views.Widget
 
+	// Keys resolves keypresses into the actions performed by the Switcher
+	Keys *keymap.Keymap
+
+	// toggles maps action names to the widgets that they switch to and from
+	toggles map[string]views.Widget
+	// others holds every widget other than the content that can be displayed
+	others []views.Widget
+
 	views.WidgetWatchers
 }
 
 // NewSwitcher creates a Switcher with the given views as its
-// Content and Log widgets.
-func NewSwitcher(app *wistTcell.Application, content, log views.Widget) *Switcher {
+// Content and Log widgets. The keys must provide bindings for
+// ActionQuit and ActionToggleLog.
+func NewSwitcher(app *wistTcell.Application, content, log views.Widget, keys *keymap.Keymap) *Switcher {
 	s := &Switcher{
 		Application:   app,
 		ContentWidget: content,
 		LogWidget:     log,
+		Keys:          keys,
 	}
 	s.Current = s.ContentWidget
 
 	// subscribe to the events of child widgets
-	log.Watch(s)
 	content.Watch(s)
+	s.AddToggle(ActionToggleLog, log)
 	return s
 }
 
+// AddToggle makes the keys bound to the named action switch between the
+// content widget and the provided widget.
+func (s *Switcher) AddToggle(action string, widget views.Widget) {
+	if s.toggles == nil {
+		s.toggles = make(map[string]views.Widget)
+	}
+	s.toggles[action] = widget
+	s.AddWidget(widget)
+}
+
+// AddWidget allows the provided widget to be displayed in place of the content
+// widget when it posts EventShowWidget.
+func (s *Switcher) AddWidget(widget views.Widget) {
+	s.others = append(s.others, widget)
+	widget.Watch(s)
+}
+
 func (s *Switcher) Draw() {
 	s.Current.Draw()
 }
 
 func (s *Switcher) Resize() {
 	s.ContentWidget.Resize()
-	s.LogWidget.Resize()
+	for _, widget := range s.others {
+		widget.Resize()
+	}
 }
 
 func (s *Switcher) SetView(view views.View) {
 	s.ContentWidget.SetView(view)
-	s.LogWidget.SetView(view)
+	for _, widget := range s.others {
+		widget.SetView(view)
+	}
 }
 
 func (s *Switcher) Size() (int, int) {
@@ -59,6 +97,12 @@ func (s *Switcher) HandleEvent(ev tcell.Event) bool {
 	case *views.EventWidgetContent:
 		// propagate content events upward
 		s.Application.Update()
+	case EventShowContent:
+		s.Current = s.ContentWidget
+		return true
+	case EventShowWidget:
+		s.Current = keyEvent.Shown
+		return true
 	case *tcell.EventMouse:
 		if s.Current.HandleEvent(ev) {
 			return true
@@ -67,13 +111,17 @@ func (s *Switcher) HandleEvent(ev tcell.Event) bool {
 		if s.Current.HandleEvent(ev) {
 			return true
 		}
-		switch keyEvent.Key() {
-		case tcell.KeyCtrlC:
+		action, result := s.Keys.Match(keyEvent)
+		switch {
+		case result == keymap.Pending:
+			return true
+		case result == keymap.NoMatch:
+		case action == ActionQuit:
 			s.Application.Quit()
-		case tcell.KeyRune:
-			switch keyEvent.Rune() {
-			case 'L':
-				s.ToggleLogWidget()
+			return true
+		default:
+			if widget, ok := s.toggles[action]; ok {
+				s.Toggle(widget)
 				return true
 			}
 		}
@@ -82,9 +130,15 @@ func (s *Switcher) HandleEvent(ev tcell.Event) bool {
 }
 
 func (s *Switcher) ToggleLogWidget() {
-	if s.Current == s.LogWidget {
+	s.Toggle(s.LogWidget)
+}
+
+// Toggle displays the provided widget, or the content widget if the provided
+// widget is already displayed.
+func (s *Switcher) Toggle(widget views.Widget) {
+	if s.Current == widget {
 		s.Current = s.ContentWidget
 		return
 	}
-	s.Current = s.LogWidget
+	s.Current = widget
 }
@@ -32,6 +32,14 @@ type Application struct {
 	err             error
 	wg              sync.WaitGroup
 	ConfigureScreen func(tcell.Screen)
+
+	// lock guards screen, events, and quit once the application is running
+	lock sync.Mutex
+	// events carries both the events of the current screen and those posted
+	// to the application, so posts survive replacing the screen
+	events chan tcell.Event
+	// quit is closed once the event loop exits
+	quit chan struct{}
 }
 
 // SetRootWidget sets the primary (root, main) Widget to be displayed.
@@ -56,9 +64,7 @@ func (app *Application) initialize() error {
 func (app *Application) Quit() {
 	ev := &eventAppQuit{}
 	ev.SetEventNow()
-	if scr := app.screen; scr != nil {
-		go func() { scr.PostEventWait(ev) }()
-	}
+	app.post(ev)
 }
 
 // Refresh causes the application forcibly redraw everything.  Use this
@@ -66,9 +72,7 @@ func (app *Application) Quit() {
 func (app *Application) Refresh() {
 	ev := &eventAppRefresh{}
 	ev.SetEventNow()
-	if scr := app.screen; scr != nil {
-		go func() { scr.PostEventWait(ev) }()
-	}
+	app.post(ev)
 }
 
 // Update asks the application to draw any screen updates that have not
@@ -76,9 +80,7 @@ func (app *Application) Refresh() {
 func (app *Application) Update() {
 	ev := &eventAppUpdate{}
 	ev.SetEventNow()
-	if scr := app.screen; scr != nil {
-		go func() { scr.PostEventWait(ev) }()
-	}
+	app.post(ev)
 }
 
 // PostFunc posts a function to be executed in the context of the
@@ -87,9 +89,86 @@ func (app *Application) Update() {
 func (app *Application) PostFunc(fn func()) {
 	ev := &eventAppFunc{fn: fn}
 	ev.SetEventNow()
-	if scr := app.screen; scr != nil {
-		go func() { scr.PostEventWait(ev) }()
+	app.post(ev)
+}
+
+// Suspend releases the terminal, runs the provided function, and then
+// restores the screen and redraws. This allows fn to run programs that need
+// the terminal, such as a text editor. Events posted while the screen is
+// suspended are delivered once it is restored.
+func (app *Application) Suspend(fn func()) {
+	ev := &eventAppSuspend{fn: fn}
+	ev.SetEventNow()
+	app.post(ev)
+}
+
+// channels returns the channel read by the event loop and the channel closed
+// when it exits, creating them if needed.
+func (app *Application) channels() (chan tcell.Event, chan struct{}) {
+	app.lock.Lock()
+	defer app.lock.Unlock()
+	if app.events == nil {
+		app.events = make(chan tcell.Event)
+		app.quit = make(chan struct{})
+	}
+	return app.events, app.quit
+}
+
+// post delivers the event to the application's event loop without blocking.
+func (app *Application) post(ev tcell.Event) {
+	events, quit := app.channels()
+	go func() {
+		select {
+		case events <- ev:
+		case <-quit:
+		}
+	}()
+}
+
+// pump forwards the events of the screen to the event loop until the screen
+// is finalized.
+func (app *Application) pump(screen tcell.Screen) {
+	events, quit := app.channels()
+	go func() {
+		for {
+			ev := screen.PollEvent()
+			if ev == nil {
+				return
+			}
+			select {
+			case events <- ev:
+			case <-quit:
+				return
+			}
+		}
+	}()
+}
+
+// suspend finalizes the current screen, runs fn, and then initializes and
+// returns a replacement screen. Events posted in the meantime wait for the
+// event loop, which is blocked until suspend returns.
+func (app *Application) suspend(screen tcell.Screen, fn func()) (tcell.Screen, error) {
+	screen.Fini()
+	fn()
+
+	replacement, err := tcell.NewScreen()
+	if err != nil {
+		return nil, err
 	}
+	if err := replacement.Init(); err != nil {
+		return nil, err
+	}
+	replacement.SetStyle(app.style)
+	replacement.Clear()
+	if app.ConfigureScreen != nil {
+		app.ConfigureScreen(replacement)
+	}
+
+	app.lock.Lock()
+	app.screen = replacement
+	app.lock.Unlock()
+	app.pump(replacement)
+	return replacement, nil
 }
 
 // SetScreen sets the screen to use for the application.  This must be
@@ -126,8 +205,12 @@ func (app *Application) run() {
 		}
 		screen = app.screen
 	}
+	events, quit := app.channels()
 	defer func() {
-		screen.Fini()
+		close(quit)
+		if screen != nil {
+			screen.Fini()
+		}
 		app.wg.Done()
 	}()
 	screen.Init()
@@ -136,6 +219,7 @@ func (app *Application) run() {
 		app.ConfigureScreen(screen)
 	}
 	widget.SetView(screen)
+	app.pump(screen)
 
 loop:
 	for {
@@ -145,7 +229,7 @@ loop:
 		widget.Draw()
 		screen.Show()
 
-		ev := screen.PollEvent()
+		ev := <-events
 		switch nev := ev.(type) {
 		case *eventAppQuit:
 			break loop
@@ -155,6 +239,13 @@ loop:
 			screen.Sync()
 		case *eventAppFunc:
 			nev.fn()
+		case *eventAppSuspend:
+			var err error
+			if screen, err = app.suspend(screen, nev.fn); err != nil {
+				app.err = err
+				break loop
+			}
+			widget.SetView(screen)
 		case *tcell.EventResize:
 			screen.Sync()
 			widget.Resize()
@@ -201,3 +292,8 @@ type eventAppFunc struct {
 	tcell.EventTime
 	fn func()
 }
+
+type eventAppSuspend struct {
+	tcell.EventTime
+	fn func()
+}
@@ -0,0 +1,66 @@
+package widgets
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell"
+	"github.com/gdamore/tcell/views"
+)
+
+// TitleBar displays the application name along with the number of unread
+// messages, whether notifications are suppressed, the community that the
+// history is restricted to, and a hint for the user.
+type TitleBar struct {
+	views.SimpleStyledTextBar
+	unread       int
+	doNotDisturb bool
+}
+
+// NewTitleBar creates a TitleBar displaying the given hint.
+func NewTitleBar(hint string) *TitleBar {
+	bar := &TitleBar{}
+	bar.SetStyle(tcell.StyleDefault.Reverse(true))
+	bar.SetLeft("%Swisteria")
+	bar.SetRight("%S" + escapeMarkup(hint))
+	return bar
+}
+
+func (t *TitleBar) HandleEvent(ev tcell.Event) bool {
+	switch event := ev.(type) {
+	case EventUnreadCount:
+		t.unread = event.Count
+		t.updateLeft()
+		return true
+	case EventDoNotDisturb:
+		t.doNotDisturb = event.Enabled
+		t.updateLeft()
+		return true
+	case EventCommunityScope:
+		if event.Community == nil {
+			t.SetCenter("%Sall communities")
+		} else {
+			t.SetCenter("%S" + escapeMarkup(string(event.Community.Name.Blob)))
+		}
+		return true
+	}
+	return false
+}
+
+// updateLeft displays the unread count and do-not-disturb status.
+func (t *TitleBar) updateLeft() {
+	left := "%Swisteria"
+	if t.unread > 0 {
+		left += fmt.Sprintf(" (%d unread)", t.unread)
+	}
+	if t.doNotDisturb {
+		left += " [do not disturb]"
+	}
+	t.SetLeft(left)
+}
+
+// escapeMarkup escapes the text so that a SimpleStyledTextBar displays it as
+// written rather than interpreting any % in it as a style.
+func escapeMarkup(text string) string {
+	return strings.ReplaceAll(text, "%", "%%")
+}